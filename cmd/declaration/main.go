@@ -0,0 +1,31 @@
+// Command declaration generates a function declaration registry for the package in the current directory,
+// it is intended to be invoked with //go:generate go run go.scnd.dev/open/model/agentic/cmd/declaration
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.scnd.dev/open/model/agentic/package/generate"
+)
+
+func main() {
+	output := flag.String("output", "declaration_generated.go", "output file name within the package directory")
+	dir := flag.String("dir", ".", "package directory to scan")
+	flag.Parse()
+
+	// * generate registry source
+	source, err := generate.Generate(*dir, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "declaration:", err.Error())
+		os.Exit(1)
+	}
+
+	// * write registry next to the scanned package
+	if err := os.WriteFile(filepath.Join(*dir, *output), source, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "declaration:", err.Error())
+		os.Exit(1)
+	}
+}
@@ -13,7 +13,7 @@ func main() {
 
 	type Person struct {
 		Name    string   `json:"name" description:"The name of the person" validate:"required"`
-		Emails  []string `json:"email" description:"The email address" validate:"required,email"`
+		Emails  []string `json:"email" description:"The email address" validate:"required,dive,email"`
 		Address *struct {
 			Street string `json:"street" validate:"required"`
 			City   string `json:"city" validate:"required"`
@@ -6,6 +6,7 @@ require (
 	github.com/anthropics/anthropic-sdk-go v1.14.0
 	github.com/bsthun/gut v1.2.7
 	github.com/davecgh/go-spew v1.1.1
+	github.com/go-playground/validator/v10 v10.28.0
 	github.com/mark3labs/mcp-go v0.41.1
 	github.com/openai/openai-go v1.12.0
 	github.com/stretchr/testify v1.9.0
@@ -17,7 +18,6 @@ require (
 	github.com/gabriel-vasile/mimetype v1.4.10 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
-	github.com/go-playground/validator/v10 v10.28.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gookit/color v1.6.0 // indirect
 	github.com/invopop/jsonschema v0.13.0 // indirect
@@ -13,7 +13,7 @@ type Agent struct {
 	Option    *Option                 `json:"option"`
 	Functions []*function.Declaration `json:"functions"`
 	Subagents []*Agent                `json:"subagents"`
-	Messages  []call.Message          `json:"messages"`
+	Messages  call.Messages           `json:"messages"`
 }
 
 func New(caller call.Caller, option *Option) *Agent {
@@ -6,7 +6,8 @@ import (
 	"go.scnd.dev/open/model/agentic/package/function"
 )
 
-// Call executes the agent with state, during execution, state passed can use to manage function calls, subagent dispatch and callback hooks
+// Call executes the agent with state, during execution, state passed can use to manage function calls, subagent dispatch and callback hooks,
+// when the function option has a state store and the function state has an id, the run is checkpointed and an interrupted run resumes from its last checkpoint
 func (r *Agent) Call(state *State, output any) (*call.Response, *gut.ErrorInstance) {
 	// * construct function caller
 	caller := function.New(r.Caller, r.Option.FunctionOption)
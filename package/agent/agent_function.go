@@ -6,17 +6,18 @@ import (
 	"go.scnd.dev/open/model/agentic/package/function"
 )
 
-// Function creates a function declaration for the agent to be used for executing from a parent agent
+// Function creates a function declaration for the agent to be used for executing from a parent agent,
+// the subagent state is checkpointed and resumed under an id derived from the parent state id
 func (r *Agent) Function(state *State) *function.Declaration {
 	type Arguments struct {
 		Task           *string `json:"task" description:"The task or question to be processed by the subagent" validate:"required"`
 		IncludeContext *bool   `json:"includeContext" description:"Whether to include the parent agent's context to subagent" validate:"required"`
 	}
 
-	declaration := function.NewDeclaration(
+	declaration := function.NewDeclarationContext(
 		gut.Ptr("call_"+*r.Option.Name),
 		r.Option.Description,
-		func(arguments *Arguments) (map[string]any, *gut.ErrorInstance) {
+		func(ctx *function.DeclarationContext, arguments *Arguments) (map[string]any, *gut.ErrorInstance) {
 			// * validate arguments
 			if arguments.Task == nil {
 				return nil, gut.Err(false, "task arguments is required", nil)
@@ -28,6 +29,11 @@ func (r *Agent) Function(state *State) *function.Declaration {
 			agentState := agent.NewState(arguments.Task)
 			agentState.FunctionState.Inherit(state.FunctionState)
 
+			// * checkpoint subagent state under the parent state id and tool call id
+			if ctx.State != nil && ctx.State.Id != nil && ctx.ToolCall != nil && ctx.ToolCall.Id != nil {
+				agentState.FunctionState.Id = gut.Ptr(*ctx.State.Id + "/" + *r.Option.Name + "/" + *ctx.ToolCall.Id)
+			}
+
 			// * include context from parent state
 			if arguments.IncludeContext != nil && *arguments.IncludeContext && state != nil && state.FunctionState != nil {
 				messages := state.FunctionState.Messages()
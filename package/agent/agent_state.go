@@ -8,7 +8,7 @@ import (
 // State manages the execution state of an agent with task and function state
 type State struct {
 	Task          *string         `json:"task"`
-	FunctionState *function.State `json:"-"`
+	FunctionState *function.State `json:"functionState"`
 }
 
 // NewState creates a new agent state with the specified task and initial messages
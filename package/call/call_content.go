@@ -0,0 +1,56 @@
+package call
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// ContentPart represents a multimodal content block attached to a tool result,
+// binary content is carried in data with its media type, or referenced by url
+type ContentPart struct {
+	Type      *ContentPartType `json:"type"`
+	Text      *string          `json:"text,omitempty"`
+	Data      []byte           `json:"data,omitempty"`
+	MediaType *string          `json:"mediaType,omitempty"`
+	Url       *string          `json:"url,omitempty"`
+	Name      *string          `json:"name,omitempty"`
+}
+
+// NewTextPart creates a text content part
+func NewTextPart(text string) *ContentPart {
+	typ := ContentPartTypeText
+	return &ContentPart{
+		Type: &typ,
+		Text: &text,
+	}
+}
+
+// NewImagePart creates an image content part from bytes with its media type such as image/png
+func NewImagePart(data []byte, mediaType string) *ContentPart {
+	typ := ContentPartTypeImage
+	return &ContentPart{
+		Type:      &typ,
+		Data:      data,
+		MediaType: &mediaType,
+	}
+}
+
+// NewDocumentPart creates a document content part from bytes with its media type such as application/pdf
+func NewDocumentPart(data []byte, mediaType string, name string) *ContentPart {
+	typ := ContentPartTypeDocument
+	return &ContentPart{
+		Type:      &typ,
+		Data:      data,
+		MediaType: &mediaType,
+		Name:      &name,
+	}
+}
+
+// DataUrl renders binary content of the part as a base64 data url
+func (r *ContentPart) DataUrl() string {
+	mediaType := "application/octet-stream"
+	if r.MediaType != nil {
+		mediaType = *r.MediaType
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(r.Data))
+}
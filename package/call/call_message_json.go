@@ -0,0 +1,113 @@
+package call
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Messages is a message history that marshals every message with its role as type discriminator,
+// so that a history stored as json can be unmarshalled back into concrete messages
+type Messages []Message
+
+// MessageMarshal marshals a message as a json object with its role in the type field
+func MessageMarshal(message Message) ([]byte, error) {
+	var role Role
+	switch message.(type) {
+	case *SystemMessage:
+		role = RoleSystem
+	case *UserMessage:
+		role = RoleUser
+	case *AssistantMessage:
+		role = RoleAssistant
+	case nil:
+		return []byte("null"), nil
+	default:
+		return nil, fmt.Errorf("unsupported message type %T", message)
+	}
+
+	content, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(content, []byte("null")) {
+		return content, nil
+	}
+
+	// * prepend type discriminator to message fields
+	typ, _ := json.Marshal(role)
+	document := []byte(`{"type":` + string(typ))
+	if len(content) > 2 {
+		document = append(document, ',')
+	}
+	return append(document, content[1:]...), nil
+}
+
+// MessageUnmarshal unmarshals a json object written by MessageMarshal into its concrete message
+func MessageUnmarshal(data []byte) (Message, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+
+	discriminator := new(struct {
+		Type *Role `json:"type"`
+	})
+	if err := json.Unmarshal(data, discriminator); err != nil {
+		return nil, err
+	}
+	if discriminator.Type == nil {
+		return nil, fmt.Errorf("message type is missing")
+	}
+
+	var message Message
+	switch *discriminator.Type {
+	case RoleSystem:
+		message = new(SystemMessage)
+	case RoleUser:
+		message = new(UserMessage)
+	case RoleAssistant:
+		message = new(AssistantMessage)
+	default:
+		return nil, fmt.Errorf("unsupported message type %q", *discriminator.Type)
+	}
+	if err := json.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (r Messages) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	documents := make([]json.RawMessage, 0, len(r))
+	for _, message := range r {
+		document, err := MessageMarshal(message)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	return json.Marshal(documents)
+}
+
+func (r *Messages) UnmarshalJSON(data []byte) error {
+	var documents []json.RawMessage
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return err
+	}
+	if documents == nil {
+		*r = nil
+		return nil
+	}
+	messages := make(Messages, 0, len(documents))
+	for _, document := range documents {
+		message, err := MessageUnmarshal(document)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+	*r = messages
+	return nil
+}
@@ -0,0 +1,54 @@
+package call
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bsthun/gut"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagesJson(t *testing.T) {
+	messages := Messages{
+		&SystemMessage{Content: gut.Ptr("You are helpful")},
+		&UserMessage{Content: gut.Ptr("Look at this"), Image: []byte{0x89, 0x50}, ImageDetail: gut.Ptr("low")},
+		&AssistantMessage{
+			Content: gut.Ptr("Checking"),
+			ToolCalls: []*ToolCall{
+				{
+					Id:        gut.Ptr("call_1"),
+					Type:      gut.Ptr("function"),
+					Name:      gut.Ptr("screenshot"),
+					Arguments: []byte(`{"full":true}`),
+					Result:    []byte(`{"width":1}`),
+					Parts:     []*ContentPart{NewImagePart([]byte{0x89}, "image/png")},
+				},
+			},
+			Usage: &Usage{InputTokens: gut.Ptr[int64](10)},
+		},
+	}
+
+	content, err := json.Marshal(messages)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `{"type":"system","content":"You are helpful"}`)
+
+	var restored Messages
+	assert.Nil(t, json.Unmarshal(content, &restored))
+	assert.Equal(t, messages, restored)
+
+	t.Run("UnknownType", func(t *testing.T) {
+		var restored Messages
+		err := json.Unmarshal([]byte(`[{"type":"developer","content":"x"}]`), &restored)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Request", func(t *testing.T) {
+		request := &Request{Messages: messages[:2]}
+		content, _ := json.Marshal(request)
+
+		restored := new(Request)
+		assert.Nil(t, json.Unmarshal(content, restored))
+		assert.IsType(t, new(UserMessage), restored.Messages[1])
+	})
+}
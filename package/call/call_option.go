@@ -4,5 +4,10 @@ package call
 type Option struct {
 	SchemaName        *string                  `json:"schemaName"`
 	SchemaDescription *string                  `json:"schemaDescription"`
+	RepairAttempts    *int                     `json:"repairAttempts"`
 	OnResponse        func(response *Response) `json:"-"`
+	// OnPartial is only supported by the OpenAI caller, other callers ignore it and it is not invoked for repair re-prompts.
+	// Each invocation receives a newly allocated instance of the output type holding the fields parsed so far,
+	// not progressive fills of the same value
+	OnPartial func(output any) `json:"-"`
 }
@@ -10,6 +10,7 @@ type Request struct {
 	TopK            *int             `json:"topK,omitempty"`
 	ExtraFields     map[string]any   `json:"extraFields,omitempty"`
 	ReasoningEffort *ReasoningEffort `json:"reasoningEffort,omitempty"`
-	Messages        []Message        `json:"messages,omitempty"`
+	Messages        Messages         `json:"messages,omitempty"`
 	Tools           []*Tool          `json:"tools,omitempty"`
+	ToolChoice      *ToolChoice      `json:"toolChoice,omitempty"`
 }
@@ -1,12 +1,35 @@
 package call
 
-// Schema represents JSON schema definitions for structured outputs
+// Schema represents JSON schema definitions for structured outputs and tool inputs,
+// keywords without a typed field, or with a value the typed field cannot hold, are kept in Extensions
 type Schema struct {
+	Ref                  *string            `json:"$ref,omitempty"`
 	Type                 *string            `json:"type,omitempty"`
+	Title                *string            `json:"title,omitempty"`
 	Description          *string            `json:"description,omitempty"`
+	Format               *string            `json:"format,omitempty"`
 	Enum                 []*string          `json:"enum,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Examples             []any              `json:"examples,omitempty"`
+	Deprecated           *bool              `json:"deprecated,omitempty"`
 	Properties           map[string]*Schema `json:"properties,omitempty"`
 	Items                *Schema            `json:"items,omitempty"`
 	Required             []*string          `json:"required,omitempty"`
 	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              *string            `json:"pattern,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Extensions           map[string]any     `json:"-"`
 }
@@ -0,0 +1,113 @@
+package call
+
+import (
+	"encoding/json"
+
+	"github.com/bsthun/gut"
+)
+
+// Tokenizer counts tokens of text for a model family
+type Tokenizer interface {
+	// Count returns the number of tokens of text
+	Count(text string) int
+}
+
+// TokenCounter is implemented by callers able to count input tokens of a request before sending it
+type TokenCounter interface {
+	// Tokens returns the input tokens of request including tools and the structured output schema of output
+	Tokens(request *Request, option *Option, output any) (int, *gut.ErrorInstance)
+}
+
+const (
+	// TokenMessage is the overhead of the role and separators of each message
+	TokenMessage = 3
+	// TokenReply is the overhead priming the assistant reply of each request
+	TokenReply = 3
+	// TokenImage is the estimated cost of an image in a message
+	TokenImage = 765
+)
+
+// TokenizerHeuristic estimates tokens as one token per four bytes of text, used when no tokenizer is available
+type TokenizerHeuristic struct{}
+
+func (r TokenizerHeuristic) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + 3) / 4
+}
+
+// TokensOf counts input tokens of request with the token counter of caller, falling back to the heuristic tokenizer
+func TokensOf(caller Caller, request *Request, option *Option, output any) (int, *gut.ErrorInstance) {
+	if counter, ok := caller.(TokenCounter); ok {
+		return counter.Tokens(request, option, output)
+	}
+	return RequestTokens(TokenizerHeuristic{}, request, output), nil
+}
+
+// RequestTokens counts input tokens of messages, tools and the structured output schema of output with tokenizer
+func RequestTokens(tokenizer Tokenizer, request *Request, output any) int {
+	if tokenizer == nil {
+		tokenizer = TokenizerHeuristic{}
+	}
+
+	tokens := TokenReply
+	for _, message := range request.Messages {
+		tokens += MessageTokens(tokenizer, message)
+	}
+
+	// * count tools as their json declaration
+	for _, tool := range request.Tools {
+		content, err := json.Marshal(tool)
+		if err != nil {
+			continue
+		}
+		tokens += tokenizer.Count(string(content))
+	}
+
+	// * count structured output schema
+	if output != nil {
+		content, err := json.Marshal(SchemaConvert(output))
+		if err == nil {
+			tokens += tokenizer.Count(string(content))
+		}
+	}
+
+	return tokens
+}
+
+// MessageTokens counts tokens of a message with its tool calls and tool results
+func MessageTokens(tokenizer Tokenizer, message Message) int {
+	tokens := TokenMessage
+	switch m := message.(type) {
+	case *SystemMessage:
+		tokens += tokenizer.Count(gut.Val(m.Content))
+	case *UserMessage:
+		tokens += tokenizer.Count(gut.Val(m.Content))
+		if len(m.Image) > 0 || m.ImageUrl != nil {
+			tokens += TokenImage
+		}
+	case *AssistantMessage:
+		tokens += tokenizer.Count(gut.Val(m.Content))
+		for _, toolCall := range m.ToolCalls {
+			tokens += TokenMessage
+			tokens += tokenizer.Count(gut.Val(toolCall.Name))
+			tokens += tokenizer.Count(string(toolCall.Arguments))
+			tokens += tokenizer.Count(string(toolCall.Result))
+			tokens += tokenizer.Count(gut.Val(toolCall.Error))
+			for _, part := range toolCall.Parts {
+				if part.Type != nil && *part.Type == ContentPartTypeText {
+					tokens += tokenizer.Count(gut.Val(part.Text))
+				} else {
+					tokens += TokenImage
+				}
+			}
+		}
+	default:
+		content, err := json.Marshal(message)
+		if err == nil {
+			tokens += tokenizer.Count(string(content))
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,84 @@
+package call
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bsthun/gut"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenSplit(t *testing.T) {
+	assert.Equal(t, []string{"Hello", " world"}, TokenSplit(TokenEncodingCl100k, "Hello world"))
+	assert.Equal(t, []string{"I", "'m", " ", " fine", "\n\n"}, TokenSplit(TokenEncodingCl100k, "I'm  fine\n\n"))
+	assert.Equal(t, []string{"123", "45", " apples", "!!", "  "}, TokenSplit(TokenEncodingCl100k, "12345 apples!!  "))
+	assert.Equal(t, []string{"Hello", "World", " don't"}, TokenSplit(TokenEncodingO200k, "HelloWorld don't"))
+	assert.Equal(t, "สวัสดี ครับ", strings.Join(TokenSplit(TokenEncodingO200k, "สวัสดี ครับ"), ""))
+	assert.Equal(t, TokenEncodingCl100k, TokenEncodingModel("gpt-4-turbo"))
+	assert.Equal(t, TokenEncodingO200k, TokenEncodingModel("gpt-4o-mini"))
+}
+
+func TestTokenizerBpe(t *testing.T) {
+	ranks := new(strings.Builder)
+	for i, token := range []string{"a", "b", "c", " ", "ab", "abc", " ab"} {
+		fmt.Fprintf(ranks, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), i)
+	}
+	tokenizer, err := NewTokenizerBpe(TokenEncodingCl100k, strings.NewReader(ranks.String()))
+	assert.Nil(t, err)
+
+	// * leftmost lowest rank pairs merge first
+	assert.Equal(t, []int{5, 4}, tokenizer.Merge("abcab"))
+	assert.Equal(t, []int{5, 3, 5}, tokenizer.Encode("abc abc"))
+	assert.Equal(t, []int{-1}, tokenizer.Encode("z"))
+	assert.Equal(t, 3, tokenizer.Count("abc abc"))
+
+	t.Run("InvalidRanks", func(t *testing.T) {
+		_, err := NewTokenizerBpe(TokenEncodingCl100k, strings.NewReader("YQ== x\n"))
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("NoRanks", func(t *testing.T) {
+		_, err := NewTokenizerBpe(TokenEncodingO200k, strings.NewReader(""))
+		assert.NotNil(t, err)
+
+		_, err = TokensOf(&ProviderOpenai{Tokenizer: new(TokenizerBpe)}, &Request{}, nil, nil)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestRequestTokens(t *testing.T) {
+	request := &Request{
+		Messages: Messages{
+			&SystemMessage{Content: gut.Ptr("You are helpful")},
+			&UserMessage{Content: gut.Ptr("What is the weather?")},
+			&AssistantMessage{
+				ToolCalls: []*ToolCall{
+					{
+						Name:      gut.Ptr("weather"),
+						Arguments: []byte(`{"city":"Bangkok"}`),
+						Result:    []byte(`{"temperature":31}`),
+					},
+				},
+			},
+		},
+	}
+
+	tokens := RequestTokens(nil, request, nil)
+	assert.Equal(t, 3+3+4+3+5+3+3+2+5+5, tokens)
+
+	// * tools and output schema add to the count
+	request.Tools = []*Tool{{Name: gut.Ptr("weather"), Description: gut.Ptr("Current weather of a city")}}
+	type Weather struct {
+		Temperature *int `json:"temperature"`
+	}
+	assert.Greater(t, RequestTokens(nil, request, new(Weather)), RequestTokens(nil, request, nil))
+	assert.Greater(t, RequestTokens(nil, request, nil), tokens)
+
+	// * callers without token counter use the heuristic tokenizer
+	count, err := TokensOf(new(ProviderOpenai), request, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, RequestTokens(TokenizerHeuristic{}, request, nil), count)
+}
@@ -12,15 +12,24 @@ type Tool struct {
 	InputSchema *Schema `json:"inputSchema,omitempty"`
 }
 
+// ToolChoice controls whether and which tools the model calls,
+// name selects the tool for ToolChoiceModeTool, and parallel allows multiple tool calls in a single response
+type ToolChoice struct {
+	Mode     *ToolChoiceMode `json:"mode,omitempty"`
+	Name     *string         `json:"name,omitempty"`
+	Parallel *bool           `json:"parallel,omitempty"`
+}
+
 // ToolCall represents a tool call information responded by the model during interaction
-// result will be filled after tool execution
+// result will be filled after tool execution, parts carry multimodal content of the result
 type ToolCall struct {
-	Id        *string `json:"id"`
-	Type      *string `json:"type"`
-	Name      *string `json:"name,omitempty"`
-	Arguments []byte  `json:"arguments,omitempty"`
-	Result    []byte  `json:"output,omitempty"`
-	Error     *string `json:"error,omitempty"`
+	Id        *string        `json:"id"`
+	Type      *string        `json:"type"`
+	Name      *string        `json:"name,omitempty"`
+	Arguments []byte         `json:"arguments,omitempty"`
+	Result    []byte         `json:"output,omitempty"`
+	Parts     []*ContentPart `json:"parts,omitempty"`
+	Error     *string        `json:"error,omitempty"`
 }
 
 func (r *ToolCall) String() string {
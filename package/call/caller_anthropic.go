@@ -3,7 +3,6 @@ package call
 import (
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -12,8 +11,12 @@ import (
 	"github.com/bsthun/gut"
 )
 
+// ProviderAnthropic calls Anthropic-compatible messages, request tokens are counted by the count tokens endpoint
+// when token endpoint is set, otherwise by tokenizer defaulting to the heuristic tokenizer
 type ProviderAnthropic struct {
-	Client *anthropic.Client
+	Client        *anthropic.Client
+	Tokenizer     Tokenizer
+	TokenEndpoint *bool
 }
 
 func NewAnthropic(baseUrl string, apiKey string) Caller {
@@ -33,6 +36,50 @@ func (r *ProviderAnthropic) Call(request *Request, option *Option, output any) (
 		return nil, gut.Err(false, "request or option is nil", nil)
 	}
 
+	// * call with structured output parsing and repair
+	return OutputRepair(request, option, output, func(request *Request) (*Response, *gut.ErrorInstance) {
+		return r.Message(request, option, output)
+	})
+}
+
+// Tokens counts input tokens of request with the count tokens endpoint or the provider tokenizer
+func (r *ProviderAnthropic) Tokens(request *Request, option *Option, output any) (int, *gut.ErrorInstance) {
+	if r.TokenEndpoint == nil || !*r.TokenEndpoint {
+		if err := TokenizerCheck(r.Tokenizer); err != nil {
+			return 0, err
+		}
+		return RequestTokens(r.Tokenizer, request, output), nil
+	}
+
+	// * convert message parameters to count tokens parameters
+	messageParams := r.RequestToMessageParams(request, option, output)
+	countParams := anthropic.MessageCountTokensParams{
+		Messages:   messageParams.Messages,
+		Model:      messageParams.Model,
+		Thinking:   messageParams.Thinking,
+		ToolChoice: messageParams.ToolChoice,
+	}
+	if len(messageParams.System) > 0 {
+		countParams.System = anthropic.MessageCountTokensParamsSystemUnion{
+			OfTextBlockArray: messageParams.System,
+		}
+	}
+	for _, tool := range messageParams.Tools {
+		countParams.Tools = append(countParams.Tools, anthropic.MessageCountTokensToolUnionParam{
+			OfTool: tool.OfTool,
+		})
+	}
+
+	count, err := (*r.Client).Messages.CountTokens(context.Background(), countParams)
+	if err != nil {
+		return 0, gut.Err(false, "failed to count anthropic tokens", err)
+	}
+
+	return int(count.InputTokens), nil
+}
+
+// Message executes a single message request with retry logic and converts it into a response
+func (r *ProviderAnthropic) Message(request *Request, option *Option, output any) (*Response, *gut.ErrorInstance) {
 	// * convert request to anthropic message parameters
 	messageParams := r.RequestToMessageParams(request, option, output)
 
@@ -57,7 +104,7 @@ func (r *ProviderAnthropic) Call(request *Request, option *Option, output any) (
 	}
 
 	// * convert anthropic response to internal format
-	response := r.MessageToResponse(message, output)
+	response := r.MessageToResponse(message)
 	if response == nil {
 		return nil, gut.Err(false, "invalid response from anthropic", nil)
 	}
@@ -110,6 +157,11 @@ func (r *ProviderAnthropic) RequestToMessageParams(request *Request, option *Opt
 	// * set tools if provided
 	if len(request.Tools) > 0 {
 		messageParams.Tools = r.RequestToTools(request.Tools)
+
+		// * set tool choice if provided
+		if request.ToolChoice != nil {
+			messageParams.ToolChoice = r.RequestToToolChoice(request.ToolChoice)
+		}
 	}
 
 	// * set extra fields from option
@@ -147,8 +199,7 @@ func (r *ProviderAnthropic) RequestToMessages(request *Request) []anthropic.Mess
 				messages = append(messages, mm)
 			}
 			for _, toolCall := range m.ToolCalls {
-				toolResultBlock := anthropic.NewToolResultBlock(*toolCall.Id, toolCall.String(), false)
-				messages = append(messages, anthropic.NewUserMessage(toolResultBlock))
+				messages = append(messages, anthropic.NewUserMessage(r.ToolCallToResultBlock(toolCall)))
 			}
 		}
 	}
@@ -156,6 +207,76 @@ func (r *ProviderAnthropic) RequestToMessages(request *Request) []anthropic.Mess
 	return messages
 }
 
+// ToolCallToResultBlock converts a resulted tool call into a tool result block with its multimodal content parts
+func (r *ProviderAnthropic) ToolCallToResultBlock(toolCall *ToolCall) anthropic.ContentBlockParamUnion {
+	if len(toolCall.Parts) == 0 {
+		return anthropic.NewToolResultBlock(*toolCall.Id, toolCall.String(), false)
+	}
+
+	// * construct tool result content with text followed by parts
+	content := []anthropic.ToolResultBlockParamContentUnion{
+		{OfText: &anthropic.TextBlockParam{Text: toolCall.String()}},
+	}
+	for _, part := range toolCall.Parts {
+		block := r.ContentPartToResultContent(part)
+		if block != nil {
+			content = append(content, *block)
+		}
+	}
+
+	return anthropic.ContentBlockParamUnion{
+		OfToolResult: &anthropic.ToolResultBlockParam{
+			ToolUseID: *toolCall.Id,
+			Content:   content,
+		},
+	}
+}
+
+// ContentPartToResultContent converts a content part into tool result content, unsupported parts are skipped
+func (r *ProviderAnthropic) ContentPartToResultContent(part *ContentPart) *anthropic.ToolResultBlockParamContentUnion {
+	if part == nil || part.Type == nil {
+		return nil
+	}
+
+	switch *part.Type {
+	case ContentPartTypeText:
+		return &anthropic.ToolResultBlockParamContentUnion{
+			OfText: &anthropic.TextBlockParam{Text: gut.Val(part.Text)},
+		}
+	case ContentPartTypeImage:
+		image := new(anthropic.ImageBlockParam)
+		if part.Url != nil {
+			image.Source.OfURL = &anthropic.URLImageSourceParam{URL: *part.Url}
+		} else {
+			image.Source.OfBase64 = &anthropic.Base64ImageSourceParam{
+				Data:      base64.StdEncoding.EncodeToString(part.Data),
+				MediaType: anthropic.Base64ImageSourceMediaType(gut.Val(part.MediaType, string(anthropic.Base64ImageSourceMediaTypeImagePNG))),
+			}
+		}
+		return &anthropic.ToolResultBlockParamContentUnion{OfImage: image}
+	case ContentPartTypeDocument:
+		document := new(anthropic.DocumentBlockParam)
+		if part.Name != nil {
+			document.Title = anthropic.String(*part.Name)
+		}
+		switch {
+		case part.Url != nil:
+			document.Source.OfURL = &anthropic.URLPDFSourceParam{URL: *part.Url}
+		case gut.Val(part.MediaType) == "application/pdf":
+			document.Source.OfBase64 = &anthropic.Base64PDFSourceParam{
+				Data: base64.StdEncoding.EncodeToString(part.Data),
+			}
+		default:
+			document.Source.OfText = &anthropic.PlainTextSourceParam{
+				Data: string(part.Data),
+			}
+		}
+		return &anthropic.ToolResultBlockParamContentUnion{OfDocument: document}
+	default:
+		return nil
+	}
+}
+
 func (r *ProviderAnthropic) UserMessageToMessageParam(message *UserMessage) anthropic.MessageParam {
 	if message == nil {
 		return anthropic.NewUserMessage(anthropic.NewTextBlock(""))
@@ -241,7 +362,7 @@ func (r *ProviderAnthropic) ToolCallToToolUseBlock(toolCall *ToolCall) anthropic
 	return anthropic.NewToolUseBlock(toolUseID, input, name)
 }
 
-func (r *ProviderAnthropic) MessageToResponse(message *anthropic.Message, output any) *Response {
+func (r *ProviderAnthropic) MessageToResponse(message *anthropic.Message) *Response {
 	if message == nil || len(message.Content) == 0 {
 		return nil
 	}
@@ -250,13 +371,13 @@ func (r *ProviderAnthropic) MessageToResponse(message *anthropic.Message, output
 		Id:           message.ID,
 		Model:        string(message.Model),
 		FinishReason: string(message.StopReason),
-		Message:      r.MessageContentToMessage(message, output),
+		Message:      r.MessageContentToMessage(message),
 	}
 
 	return response
 }
 
-func (r *ProviderAnthropic) MessageContentToMessage(message *anthropic.Message, output any) *AssistantMessage {
+func (r *ProviderAnthropic) MessageContentToMessage(message *anthropic.Message) *AssistantMessage {
 	result := &AssistantMessage{
 		Content:   nil,
 		ToolCalls: nil,
@@ -280,12 +401,9 @@ func (r *ProviderAnthropic) MessageContentToMessage(message *anthropic.Message,
 		}
 	}
 
-	// * unmarshal structured output
-	if output != nil && content != "" {
-		content = ContentClean(content)
-		if err := json.Unmarshal([]byte(content), output); err != nil {
-			gut.Debug("failed to unmarshal output content", err)
-		}
+	// * set content
+	if content != "" {
+		result.Content = &content
 	}
 
 	// * set tool calls
@@ -326,12 +444,22 @@ func (r *ProviderAnthropic) RequestToTools(tools []*Tool) []anthropic.ToolUnionP
 			continue
 		}
 
-		// * convert input schema
+		// * convert input schema, keeping keywords other than properties and required as extra fields
 		var parameters anthropic.ToolInputSchemaParam
 		if tool.InputSchema != nil {
-			// * convert schema recursively to handle items properly
-			schemaBytes, _ := json.Marshal(tool.InputSchema)
-			_ = json.Unmarshal(schemaBytes, &parameters)
+			document, err := SchemaDocumentValue(tool.InputSchema)
+			if err == nil {
+				parameters.Properties = document["properties"]
+				for _, required := range tool.InputSchema.Required {
+					parameters.Required = append(parameters.Required, gut.Val(required))
+				}
+				delete(document, "type")
+				delete(document, "properties")
+				delete(document, "required")
+				if len(document) > 0 {
+					parameters.ExtraFields = document
+				}
+			}
 		}
 
 		// * set tool name
@@ -343,3 +471,37 @@ func (r *ProviderAnthropic) RequestToTools(tools []*Tool) []anthropic.ToolUnionP
 
 	return anthropicTools
 }
+
+func (r *ProviderAnthropic) RequestToToolChoice(toolChoice *ToolChoice) anthropic.ToolChoiceUnionParam {
+	// * anthropic disables parallel tool use instead of enabling it
+	disableParallel := anthropic.Bool(false)
+	if toolChoice.Parallel != nil {
+		disableParallel = anthropic.Bool(!*toolChoice.Parallel)
+	}
+
+	switch gut.Val(toolChoice.Mode) {
+	case ToolChoiceModeNone:
+		return anthropic.ToolChoiceUnionParam{
+			OfNone: &anthropic.ToolChoiceNoneParam{},
+		}
+	case ToolChoiceModeRequired:
+		return anthropic.ToolChoiceUnionParam{
+			OfAny: &anthropic.ToolChoiceAnyParam{
+				DisableParallelToolUse: disableParallel,
+			},
+		}
+	case ToolChoiceModeTool:
+		return anthropic.ToolChoiceUnionParam{
+			OfTool: &anthropic.ToolChoiceToolParam{
+				Name:                   gut.Val(toolChoice.Name),
+				DisableParallelToolUse: disableParallel,
+			},
+		}
+	default:
+		return anthropic.ToolChoiceUnionParam{
+			OfAuto: &anthropic.ToolChoiceAutoParam{
+				DisableParallelToolUse: disableParallel,
+			},
+		}
+	}
+}
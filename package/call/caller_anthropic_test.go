@@ -2,6 +2,7 @@ package call
 
 import (
 	"bytes"
+	"encoding/json"
 	"image"
 	"image/color"
 	"image/png"
@@ -188,3 +189,51 @@ func TestAnthropicCaller(t *testing.T) {
 		assert.NotNil(t, output)
 	})
 }
+
+func TestAnthropicToolChoice(t *testing.T) {
+	caller := &ProviderAnthropic{}
+
+	t.Run("Required", func(t *testing.T) {
+		request := &Request{
+			Tools: []*Tool{{Name: gut.Ptr("current_weather")}},
+			ToolChoice: &ToolChoice{
+				Mode:     gut.Ptr(ToolChoiceModeRequired),
+				Parallel: gut.Ptr(false),
+			},
+		}
+
+		messageParams := caller.RequestToMessageParams(request, new(Option), nil)
+		content, _ := json.Marshal(messageParams.ToolChoice)
+
+		assert.JSONEq(t, `{"type":"any","disable_parallel_tool_use":true}`, string(content))
+	})
+}
+
+func TestAnthropicToolResultParts(t *testing.T) {
+	caller := &ProviderAnthropic{}
+	request := &Request{
+		Messages: []Message{
+			&AssistantMessage{
+				ToolCalls: []*ToolCall{
+					{
+						Id:     gut.Ptr("call_1"),
+						Name:   gut.Ptr("screenshot"),
+						Result: []byte(`{"width":1}`),
+						Parts: []*ContentPart{
+							NewImagePart([]byte{0x89}, "image/png"),
+							NewDocumentPart([]byte("hello"), "text/plain", "notes.txt"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	messages := caller.RequestToMessages(request)
+	content, _ := json.Marshal(messages)
+
+	assert.Len(t, messages, 2)
+	assert.Len(t, messages[1].Content[0].OfToolResult.Content, 3)
+	assert.Contains(t, string(content), `"data":"iQ==","media_type":"image/png"`)
+	assert.Contains(t, string(content), `"title":"notes.txt"`)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bsthun/gut"
@@ -14,8 +15,11 @@ import (
 	"github.com/openai/openai-go/shared"
 )
 
+// ProviderOpenai calls OpenAI-compatible chat completions, tokenizer counts request tokens offline
+// and defaults to the heuristic tokenizer when unset
 type ProviderOpenai struct {
-	Client *openai.Client
+	Client    *openai.Client
+	Tokenizer Tokenizer
 }
 
 func NewOpenai(baseUrl string, apiKey string) Caller {
@@ -34,6 +38,29 @@ func (r *ProviderOpenai) Call(request *Request, option *Option, output any) (*Re
 		return nil, gut.Err(false, "request or option is nil", nil)
 	}
 
+	// * call with structured output parsing and repair, reporting partial output of the first attempt only
+	attempt := 0
+	return OutputRepair(request, option, output, func(request *Request) (*Response, *gut.ErrorInstance) {
+		attempt++
+		if attempt > 1 && option.OnPartial != nil {
+			repairOption := *option
+			repairOption.OnPartial = nil
+			return r.Completion(request, &repairOption, output)
+		}
+		return r.Completion(request, option, output)
+	})
+}
+
+// Tokens counts input tokens of request with the provider tokenizer
+func (r *ProviderOpenai) Tokens(request *Request, option *Option, output any) (int, *gut.ErrorInstance) {
+	if err := TokenizerCheck(r.Tokenizer); err != nil {
+		return 0, err
+	}
+	return RequestTokens(r.Tokenizer, request, output), nil
+}
+
+// Completion executes a single streaming chat completion and accumulates it into a response
+func (r *ProviderOpenai) Completion(request *Request, option *Option, output any) (*Response, *gut.ErrorInstance) {
 	// * convert request to openai chat parameters
 	chatParams := r.RequestToChatParams(request, option, output)
 
@@ -57,6 +84,8 @@ func (r *ProviderOpenai) Call(request *Request, option *Option, output any) (*Re
 
 	// * call openai streaming api
 	stream := r.Client.Chat.Completions.NewStreaming(context.Background(), chatParams)
+	partial := ""
+	delta := ""
 	for stream.Next() {
 		chunk := stream.Current()
 
@@ -85,6 +114,9 @@ func (r *ProviderOpenai) Call(request *Request, option *Option, output any) (*Re
 			// * accumulate content
 			if choice.Delta.Content != "" {
 				completion.Choices[choice.Index].Message.Content += choice.Delta.Content
+				if choice.Index == 0 && option.OnPartial != nil {
+					delta += choice.Delta.Content
+				}
 			}
 
 			// * accumulate tool calls
@@ -140,6 +172,16 @@ func (r *ProviderOpenai) Call(request *Request, option *Option, output any) (*Re
 			response := r.ChatCompletionToResponse(completion)
 			option.OnResponse(response)
 		}
+
+		// * report partial structured output, parsing again only when a chunk may complete a value
+		if output != nil && option.OnPartial != nil && len(completion.Choices[0].Message.ToolCalls) == 0 && OutputPartialBoundary(delta) {
+			delta = ""
+			instance, content := OutputPartial(completion.Choices[0].Message.Content, output)
+			if instance != nil && content != partial {
+				partial = content
+				option.OnPartial(instance)
+			}
+		}
 	}
 
 	// * check for streaming errors
@@ -153,14 +195,6 @@ func (r *ProviderOpenai) Call(request *Request, option *Option, output any) (*Re
 		return nil, gut.Err(false, "invalid response from openai", nil)
 	}
 
-	// * parse response content
-	if output != nil && response.Message != nil && response.Message.Content != nil {
-		*response.Message.Content = ContentClean(*response.Message.Content)
-		if err := json.Unmarshal([]byte(*response.Message.Content), output); err != nil {
-			return nil, gut.Err(false, "failed to unmarshal response content to output", err)
-		}
-	}
-
 	return response, nil
 }
 
@@ -198,6 +232,14 @@ func (r *ProviderOpenai) RequestToChatParams(request *Request, option *Option, o
 	if len(request.Tools) > 0 {
 		chatParams.ParallelToolCalls = openai.Bool(true)
 		chatParams.Tools = r.RequestToTools(request.Tools)
+
+		// * set tool choice if provided
+		if request.ToolChoice != nil {
+			chatParams.ToolChoice = r.RequestToToolChoice(request.ToolChoice)
+			if request.ToolChoice.Parallel != nil {
+				chatParams.ParallelToolCalls = openai.Bool(*request.ToolChoice.Parallel)
+			}
+		}
 	}
 
 	// * set extra fields from option
@@ -208,12 +250,17 @@ func (r *ProviderOpenai) RequestToChatParams(request *Request, option *Option, o
 	// * set output format if output schema is provided
 	if output != nil {
 		schema := SchemaConvert(output)
+
+		// * fallback to schema metadata when option does not name or describe the schema
+		schemaName := gut.Val(option.SchemaName, r.SchemaName(gut.Val(schema.Title)))
+		schemaDescription := gut.Val(option.SchemaDescription, gut.Val(schema.Description))
+
 		chatParams.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
 			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
 				Type: "json_schema",
 				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
-					Name:        gut.Val(option.SchemaName),
-					Description: openai.String(gut.Val(option.SchemaDescription)),
+					Name:        schemaName,
+					Description: openai.String(schemaDescription),
 					Schema:      schema,
 					Strict:      openai.Bool(true),
 				},
@@ -250,12 +297,68 @@ func (r *ProviderOpenai) RequestToMessages(request *Request) []openai.ChatComple
 			for _, toolCall := range m.ToolCalls {
 				messages = append(messages, openai.ToolMessage(toolCall.String(), *toolCall.Id))
 			}
+
+			// * forward multimodal tool results as a user message since tool messages only accept text
+			for _, toolCall := range m.ToolCalls {
+				if contentParts := r.ToolCallToContentParts(toolCall); len(contentParts) > 0 {
+					messages = append(messages, openai.ChatCompletionMessageParamUnion{
+						OfUser: &openai.ChatCompletionUserMessageParam{
+							Role: "user",
+							Content: openai.ChatCompletionUserMessageParamContentUnion{
+								OfArrayOfContentParts: contentParts,
+							},
+						},
+					})
+				}
+			}
 		}
 	}
 
 	return messages
 }
 
+// ToolCallToContentParts converts multimodal parts of a tool call result into user content parts,
+// it returns nil when the tool call has no supported parts
+func (r *ProviderOpenai) ToolCallToContentParts(toolCall *ToolCall) []openai.ChatCompletionContentPartUnionParam {
+	var contentParts []openai.ChatCompletionContentPartUnionParam
+	for _, part := range toolCall.Parts {
+		if part == nil || part.Type == nil {
+			continue
+		}
+		switch *part.Type {
+		case ContentPartTypeText:
+			contentParts = append(contentParts, openai.TextContentPart(gut.Val(part.Text)))
+		case ContentPartTypeImage:
+			imageUrl := gut.Val(part.Url)
+			if part.Url == nil {
+				imageUrl = part.DataUrl()
+			}
+			contentParts = append(contentParts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+				URL: imageUrl,
+			}))
+		case ContentPartTypeDocument:
+			if part.Url != nil {
+				contentParts = append(contentParts, openai.TextContentPart("Document: "+*part.Url))
+				continue
+			}
+			file := openai.ChatCompletionContentPartFileFileParam{
+				FileData: openai.String(part.DataUrl()),
+			}
+			if part.Name != nil {
+				file.Filename = openai.String(*part.Name)
+			}
+			contentParts = append(contentParts, openai.FileContentPart(file))
+		}
+	}
+	if len(contentParts) == 0 {
+		return nil
+	}
+
+	// * label parts with the tool call they belong to
+	label := openai.TextContentPart(fmt.Sprintf("Content of tool call %s (%s) result:", gut.Val(toolCall.Id), gut.Val(toolCall.Name)))
+	return append([]openai.ChatCompletionContentPartUnionParam{label}, contentParts...)
+}
+
 func (r *ProviderOpenai) UserMessageToChatParam(message *UserMessage) openai.ChatCompletionMessageParamUnion {
 	if message == nil {
 		return openai.UserMessage("")
@@ -410,6 +513,31 @@ func (r *ProviderOpenai) RequestToTools(tools []*Tool) []openai.ChatCompletionTo
 	return openaiTools
 }
 
+func (r *ProviderOpenai) RequestToToolChoice(toolChoice *ToolChoice) openai.ChatCompletionToolChoiceOptionUnionParam {
+	switch gut.Val(toolChoice.Mode) {
+	case ToolChoiceModeNone:
+		return openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfAuto: openai.String(string(openai.ChatCompletionToolChoiceOptionAutoNone)),
+		}
+	case ToolChoiceModeRequired:
+		return openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfAuto: openai.String(string(openai.ChatCompletionToolChoiceOptionAutoRequired)),
+		}
+	case ToolChoiceModeTool:
+		return openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfChatCompletionNamedToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{
+					Name: gut.Val(toolChoice.Name),
+				},
+			},
+		}
+	default:
+		return openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfAuto: openai.String(string(openai.ChatCompletionToolChoiceOptionAutoAuto)),
+		}
+	}
+}
+
 func (r *ProviderOpenai) ChatCompletionToolCallToToolCall(toolCall openai.ChatCompletionMessageToolCall) *ToolCall {
 	typeStr := string(toolCall.Type)
 	result := &ToolCall{
@@ -427,3 +555,21 @@ func (r *ProviderOpenai) ChatCompletionToolCallToToolCall(toolCall openai.ChatCo
 
 	return result
 }
+
+// SchemaName converts a free-text schema title into a response format name matching ^[a-zA-Z0-9_-]{1,64}$,
+// other characters are replaced by underscores
+func (r *ProviderOpenai) SchemaName(title string) string {
+	var builder strings.Builder
+	for _, c := range title {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			builder.WriteRune(c)
+		} else if !strings.HasSuffix(builder.String(), "_") {
+			builder.WriteByte('_')
+		}
+	}
+	name := strings.Trim(builder.String(), "_")
+	if len(name) > 64 {
+		name = strings.TrimRight(name[:64], "_")
+	}
+	return name
+}
@@ -7,6 +7,7 @@ import (
 	"image/color"
 	"image/png"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/bsthun/gut"
@@ -170,3 +171,69 @@ func TestOpenaiCaller(t *testing.T) {
 		assert.NotNil(t, output.Name)
 	})
 }
+
+func TestOpenaiToolChoice(t *testing.T) {
+	caller := &ProviderOpenai{}
+
+	t.Run("NamedTool", func(t *testing.T) {
+		request := &Request{
+			Tools: []*Tool{{Name: gut.Ptr("current_weather")}},
+			ToolChoice: &ToolChoice{
+				Mode:     gut.Ptr(ToolChoiceModeTool),
+				Name:     gut.Ptr("current_weather"),
+				Parallel: gut.Ptr(false),
+			},
+		}
+
+		chatParams := caller.RequestToChatParams(request, new(Option), nil)
+		content, _ := json.Marshal(chatParams)
+
+		assert.Contains(t, string(content), `"tool_choice":{"function":{"name":"current_weather"},"type":"function"}`)
+		assert.Contains(t, string(content), `"parallel_tool_calls":false`)
+	})
+
+	t.Run("WithoutTools", func(t *testing.T) {
+		request := &Request{
+			ToolChoice: &ToolChoice{Mode: gut.Ptr(ToolChoiceModeNone)},
+		}
+
+		chatParams := caller.RequestToChatParams(request, new(Option), nil)
+		content, _ := json.Marshal(chatParams)
+
+		assert.NotContains(t, string(content), "tool_choice")
+	})
+}
+
+func TestOpenaiToolResultParts(t *testing.T) {
+	caller := &ProviderOpenai{}
+	request := &Request{
+		Messages: []Message{
+			&AssistantMessage{
+				ToolCalls: []*ToolCall{
+					{
+						Id:     gut.Ptr("call_1"),
+						Name:   gut.Ptr("screenshot"),
+						Result: []byte(`{"width":1}`),
+						Parts:  []*ContentPart{NewImagePart([]byte{0x89}, "image/png")},
+					},
+				},
+			},
+		},
+	}
+
+	messages := caller.RequestToMessages(request)
+	content, _ := json.Marshal(messages)
+
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "call_1", messages[0].OfTool.ToolCallID)
+	assert.Contains(t, string(content), `"url":"data:image/png;base64,iQ=="`)
+}
+
+func TestOpenaiSchemaName(t *testing.T) {
+	caller := &ProviderOpenai{}
+
+	assert.Equal(t, "My_Person", caller.SchemaName("My Person"))
+	assert.Equal(t, "weather-report_v2", caller.SchemaName(" weather-report (v2) "))
+	assert.Len(t, caller.SchemaName(strings.Repeat("a", 100)), 64)
+	assert.Equal(t, "", caller.SchemaName("ข้อมูล"))
+}
@@ -16,3 +16,20 @@ const (
 	ReasoningEffortMedium ReasoningEffort = "medium"
 	ReasoningEffortHigh   ReasoningEffort = "high"
 )
+
+type ToolChoiceMode string
+
+const (
+	ToolChoiceModeAuto     ToolChoiceMode = "auto"
+	ToolChoiceModeNone     ToolChoiceMode = "none"
+	ToolChoiceModeRequired ToolChoiceMode = "required"
+	ToolChoiceModeTool     ToolChoiceMode = "tool"
+)
+
+type ContentPartType string
+
+const (
+	ContentPartTypeText     ContentPartType = "text"
+	ContentPartTypeImage    ContentPartType = "image"
+	ContentPartTypeDocument ContentPartType = "document"
+)
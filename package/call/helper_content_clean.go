@@ -1,23 +1,18 @@
 package call
 
-import "strings"
+import "encoding/json"
 
+// ContentClean extracts the most likely json content from a model response,
+// it returns the first extracted candidate that is valid json, or the content unchanged when nothing is found
 func ContentClean(content string) string {
-	bracketIndex := strings.Index(content, "{")
-	squareBracketIndex := strings.Index(content, "[")
-	if bracketIndex != -1 && (squareBracketIndex == -1 || bracketIndex < squareBracketIndex) {
-		content = content[bracketIndex:]
-		endIndex := strings.LastIndex(content, "}")
-		if endIndex != -1 {
-			content = content[:endIndex+1]
+	candidates := ContentExtract(content, "")
+	for _, candidate := range candidates {
+		if json.Valid([]byte(candidate)) {
+			return candidate
 		}
 	}
-	if squareBracketIndex != -1 && (bracketIndex == -1 || squareBracketIndex < bracketIndex) {
-		content = content[squareBracketIndex:]
-		endIndex := strings.LastIndex(content, "]")
-		if endIndex != -1 {
-			content = content[:endIndex+1]
-		}
+	if len(candidates) > 0 {
+		return candidates[0]
 	}
 
 	return content
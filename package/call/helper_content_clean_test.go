@@ -2,10 +2,12 @@ package call
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestContentClean(t *testing.T) {
-	t.Run("clean json content with code block", func(t *testing.T) {
+	t.Run("CodeBlock", func(t *testing.T) {
 		input := "```json\n{\"name\": \"test\", \"value\": 123}\n```"
 		expected := "{\"name\": \"test\", \"value\": 123}"
 		result := ContentClean(input)
@@ -13,4 +15,62 @@ func TestContentClean(t *testing.T) {
 			t.Errorf("expected %q, got %q", expected, result)
 		}
 	})
+
+	t.Run("SkipProseBraces", func(t *testing.T) {
+		input := "Use the {name} placeholder, here is the result: {\"name\": \"test\"} done."
+		assert.Equal(t, "{\"name\": \"test\"}", ContentClean(input))
+	})
+
+	t.Run("PreferJsonFence", func(t *testing.T) {
+		input := "Example {\"a\": 1}\n```go\nx := []int{1}\n```\n```json\n{\"b\": 2}\n```"
+		assert.Equal(t, "{\"b\": 2}", ContentClean(input))
+	})
+
+	t.Run("BraceInsideString", func(t *testing.T) {
+		input := "{\"text\": \"closing } bracket\"} trailing }"
+		assert.Equal(t, "{\"text\": \"closing } bracket\"}", ContentClean(input))
+	})
+}
+
+func TestContentRepair(t *testing.T) {
+	t.Run("TrailingComma", func(t *testing.T) {
+		assert.Equal(t, "{\"a\": [1, 2]}", ContentRepair("{\"a\": [1, 2,],}", ""))
+	})
+
+	t.Run("SingleQuote", func(t *testing.T) {
+		assert.Equal(t, "{\"a\": \"it's \\\"ok\\\"\"}", ContentRepair("{'a': 'it\\'s \"ok\"'}", ""))
+	})
+
+	t.Run("TruncatedString", func(t *testing.T) {
+		assert.Equal(t, "{\"a\": [1, 2], \"b\": \"hel\"}", ContentRepair("{\"a\": [1, 2], \"b\": \"hel", FinishReasonLength))
+	})
+
+	t.Run("TruncatedKey", func(t *testing.T) {
+		assert.Equal(t, "{\"a\": [1, 2]}", ContentRepair("{\"a\": [1, 2], \"b", FinishReasonLength))
+	})
+
+	t.Run("UnclosedWithoutLength", func(t *testing.T) {
+		assert.Equal(t, "{\"a\": [1, 2]", ContentRepair("{\"a\": [1, 2]", "stop"))
+		assert.Equal(t, "{\"a\": [1, 2]}", ContentRepair("{\"a\": [1, 2]", "max_tokens"))
+	})
+
+	t.Run("TruncatedColon", func(t *testing.T) {
+		assert.Equal(t, "{\"a\": 1, \"b\": null}", ContentRepair("{\"a\": 1, \"b\":", FinishReasonLength))
+	})
+}
+
+func TestOutputParse(t *testing.T) {
+	t.Run("ChooseMatchingCandidate", func(t *testing.T) {
+		type Output struct {
+			Name string `json:"name" validate:"required"`
+		}
+		content := "First {\"other\": true} then {\"name\": \"test\"}"
+		output := new(Output)
+
+		parsed, err := OutputParse(content, "stop", output)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "{\"name\": \"test\"}", parsed)
+		assert.Equal(t, "test", output.Name)
+	})
 }
@@ -0,0 +1,158 @@
+package call
+
+import (
+	"strings"
+)
+
+// ContentExtract scans content for json candidates in preference order,
+// json fenced code blocks come first, then other fenced code blocks, then balanced bracket blocks in text order,
+// every candidate is passed through ContentRepair with finish reason before returned
+func ContentExtract(content string, finishReason string) []string {
+	candidates := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, block := range ContentExtractRaw(content) {
+		block = ContentRepair(block, finishReason)
+		if block == "" || seen[block] {
+			continue
+		}
+		seen[block] = true
+		candidates = append(candidates, block)
+	}
+
+	return candidates
+}
+
+// ContentExtractRaw returns unrepaired json candidate blocks in the same preference order as ContentExtract
+func ContentExtractRaw(content string) []string {
+	blocks := make([]string, 0)
+
+	// * prefer json fenced code blocks
+	fences, others := ContentExtractFences(content)
+	for _, fence := range fences {
+		blocks = append(blocks, ContentExtractBlocks(fence)...)
+	}
+	for _, fence := range others {
+		blocks = append(blocks, ContentExtractBlocks(fence)...)
+	}
+
+	// * fallback to bracket blocks over the whole content
+	blocks = append(blocks, ContentExtractBlocks(content)...)
+
+	return blocks
+}
+
+// ContentExtractFences returns bodies of ```json fenced code blocks and of other fenced code blocks separately,
+// an unterminated fence at the end of content is treated as truncated output and returned as well
+func ContentExtractFences(content string) ([]string, []string) {
+	fences := make([]string, 0)
+	others := make([]string, 0)
+
+	rest := content
+	for {
+		start := strings.Index(rest, "```")
+		if start == -1 {
+			break
+		}
+		rest = rest[start+3:]
+
+		// * read info string until end of line
+		lineEnd := strings.IndexByte(rest, '\n')
+		if lineEnd == -1 {
+			break
+		}
+		info := strings.ToLower(strings.TrimSpace(rest[:lineEnd]))
+		rest = rest[lineEnd+1:]
+
+		// * read body until closing fence
+		body := rest
+		end := strings.Index(rest, "```")
+		if end != -1 {
+			body = rest[:end]
+			rest = rest[end+3:]
+		} else {
+			rest = ""
+		}
+
+		if info == "json" || info == "jsonc" || info == "json5" {
+			fences = append(fences, body)
+		} else {
+			others = append(others, body)
+		}
+
+		if end == -1 {
+			break
+		}
+	}
+
+	return fences, others
+}
+
+// ContentExtractBlocks scans content for top-level balanced bracket blocks while respecting strings,
+// a block still open at the end of content is returned as is for ContentRepair to close
+func ContentExtractBlocks(content string) []string {
+	blocks := make([]string, 0)
+
+	for i := 0; i < len(content); i++ {
+		if content[i] != '{' && content[i] != '[' {
+			continue
+		}
+
+		end := ContentExtractBlockEnd(content, i)
+		if end == -1 {
+			blocks = append(blocks, content[i:])
+			break
+		}
+		blocks = append(blocks, content[i:end+1])
+		i = end
+	}
+
+	return blocks
+}
+
+// ContentExtractBlockEnd returns the index of the bracket closing the block opened at start, or -1 when unterminated
+func ContentExtractBlockEnd(content string, start int) int {
+	depth := 0
+	var quote byte
+	escape := false
+	previous := byte(0)
+
+	for i := start; i < len(content); i++ {
+		c := content[i]
+
+		// * inside string
+		if quote != 0 {
+			if escape {
+				escape = false
+			} else if c == '\\' {
+				escape = true
+			} else if c == quote {
+				quote = 0
+				previous = c
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			quote = c
+		case '\'':
+			// * single quotes only open strings at value or key positions, not apostrophes in prose
+			if previous == '{' || previous == '[' || previous == ',' || previous == ':' {
+				quote = c
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			previous = c
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,170 @@
+package call
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ContentRepairCut records a position in repaired output where the json can be truncated and closed
+type ContentRepairCut struct {
+	Position int
+	Stack    []byte
+}
+
+// FinishReasonLength is the finish reason of output truncated by the max tokens limit,
+// anthropic reports max_tokens for the same case
+const FinishReasonLength = "length"
+
+// ContentTruncated reports whether finish reason means the output was cut by the max tokens limit
+func ContentTruncated(finishReason string) bool {
+	return finishReason == FinishReasonLength || finishReason == "max_tokens"
+}
+
+// ContentRepair fixes common json defects produced by language models,
+// it converts single quoted strings and removes trailing commas,
+// brackets left open are only closed when finish reason reports truncated output
+func ContentRepair(content string, finishReason string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return content
+	}
+
+	repaired, cuts, stack, open := ContentRepairScan(content)
+	if (!open && len(stack) == 0) || !ContentTruncated(finishReason) {
+		return repaired
+	}
+
+	// * close truncated output, falling back to earlier cut positions until valid
+	closed := ContentRepairClose(repaired, stack, open)
+	if json.Valid([]byte(closed)) {
+		return closed
+	}
+	for i := len(cuts) - 1; i >= 0; i-- {
+		candidate := ContentRepairClose(repaired[:cuts[i].Position], cuts[i].Stack, false)
+		if json.Valid([]byte(candidate)) {
+			return candidate
+		}
+	}
+
+	return closed
+}
+
+// ContentRepairScan rewrites content into json syntax and returns the rewritten content,
+// the cut positions after each complete member, the unclosed bracket stack and whether a string is left open
+func ContentRepairScan(content string) (string, []*ContentRepairCut, []byte, bool) {
+	var builder strings.Builder
+	cuts := make([]*ContentRepairCut, 0)
+	stack := make([]byte, 0)
+	var quote byte
+	escape := false
+	previous := byte(0)
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		// * inside string
+		if quote != 0 {
+			if escape {
+				escape = false
+				if c == '\'' {
+					builder.WriteByte('\'')
+				} else {
+					builder.WriteByte('\\')
+					builder.WriteByte(c)
+				}
+				continue
+			}
+			switch {
+			case c == '\\':
+				escape = true
+			case c == quote:
+				builder.WriteByte('"')
+				quote = 0
+				previous = '"'
+			case c == '"':
+				builder.WriteString("\\\"")
+			case c == '\n':
+				builder.WriteString("\\n")
+			default:
+				builder.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			quote = c
+			builder.WriteByte('"')
+		case '\'':
+			if previous == '{' || previous == '[' || previous == ',' || previous == ':' {
+				quote = c
+				builder.WriteByte('"')
+			} else {
+				builder.WriteByte(c)
+			}
+		case '{', '[':
+			stack = append(stack, c)
+			builder.WriteByte(c)
+			cuts = append(cuts, &ContentRepairCut{Position: builder.Len(), Stack: append([]byte(nil), stack...)})
+		case '}', ']':
+			ContentRepairTrimComma(&builder)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			builder.WriteByte(c)
+			if len(stack) > 0 {
+				cuts = append(cuts, &ContentRepairCut{Position: builder.Len(), Stack: append([]byte(nil), stack...)})
+			}
+		case ',':
+			cuts = append(cuts, &ContentRepairCut{Position: builder.Len(), Stack: append([]byte(nil), stack...)})
+			builder.WriteByte(c)
+		default:
+			builder.WriteByte(c)
+		}
+
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			previous = c
+		}
+	}
+
+	return builder.String(), cuts, stack, quote != 0
+}
+
+// ContentRepairClose closes an open string and the remaining brackets of content
+func ContentRepairClose(content string, stack []byte, open bool) string {
+	var builder strings.Builder
+	builder.WriteString(content)
+	if open {
+		builder.WriteByte('"')
+	}
+
+	// * drop dangling separators and complete dangling keys
+	ContentRepairTrimComma(&builder)
+	trimmed := strings.TrimRight(builder.String(), " \t\r\n")
+	if strings.HasSuffix(trimmed, ":") {
+		builder.Reset()
+		builder.WriteString(trimmed)
+		builder.WriteString(" null")
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			builder.WriteByte('}')
+		} else {
+			builder.WriteByte(']')
+		}
+	}
+
+	return builder.String()
+}
+
+// ContentRepairTrimComma removes a trailing comma and whitespace from builder
+func ContentRepairTrimComma(builder *strings.Builder) {
+	content := builder.String()
+	trimmed := strings.TrimRight(content, " \t\r\n")
+	if !strings.HasSuffix(trimmed, ",") {
+		return
+	}
+	builder.Reset()
+	builder.WriteString(strings.TrimRight(trimmed[:len(trimmed)-1], " \t\r\n"))
+}
@@ -0,0 +1,84 @@
+package call
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// OutputPartial parses partially streamed content into a new instance of the output type,
+// it returns the instance with the repaired json that was parsed, or nil when nothing can be parsed yet
+func OutputPartial(content string, output any) (any, string) {
+	typ := reflect.TypeOf(output)
+	if typ == nil {
+		return nil, ""
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	for _, block := range ContentExtractRaw(content) {
+		partial := ContentPartial(block)
+		if partial == "" {
+			continue
+		}
+
+		instance := reflect.New(typ).Interface()
+		if err := json.Unmarshal([]byte(partial), instance); err != nil {
+			continue
+		}
+		return instance, partial
+	}
+
+	return nil, ""
+}
+
+// OutputPartialBoundary reports whether a streamed content delta contains a quote, closing bracket or comma,
+// partial output only changes when a string, value or element completes so other deltas need no parsing
+func OutputPartialBoundary(delta string) bool {
+	return strings.ContainsAny(delta, "\"}],")
+}
+
+// ContentPartial repairs truncated json for partial parsing,
+// unlike ContentRepair, an unfinished element of the innermost open array is dropped,
+// so arrays only contain elements that have completed
+func ContentPartial(content string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return content
+	}
+
+	repaired, cuts, stack, open := ContentRepairScan(content)
+	if !open && len(stack) == 0 {
+		return repaired
+	}
+
+	// * find innermost open array
+	depth := -1
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '[' {
+			depth = i + 1
+			break
+		}
+	}
+
+	for i := len(cuts); i >= 0; i-- {
+		var candidate string
+		if i == len(cuts) {
+			if depth != -1 {
+				continue
+			}
+			candidate = ContentRepairClose(repaired, stack, open)
+		} else {
+			if depth != -1 && len(cuts[i].Stack) != depth {
+				continue
+			}
+			candidate = ContentRepairClose(repaired[:cuts[i].Position], cuts[i].Stack, false)
+		}
+		if json.Valid([]byte(candidate)) {
+			return candidate
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,50 @@
+package call
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputPartial(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type Output struct {
+		Title string  `json:"title"`
+		Items []*Item `json:"items"`
+	}
+
+	t.Run("Boundary", func(t *testing.T) {
+		assert.False(t, OutputPartialBoundary("Hel"))
+		assert.True(t, OutputPartialBoundary("lo\", "))
+		assert.True(t, OutputPartialBoundary("}]"))
+	})
+
+	t.Run("PartialString", func(t *testing.T) {
+		instance, _ := OutputPartial("{\"title\": \"Hel", new(Output))
+
+		assert.NotNil(t, instance)
+		assert.Equal(t, "Hel", instance.(*Output).Title)
+	})
+
+	t.Run("CompletedArrayElements", func(t *testing.T) {
+		instance, _ := OutputPartial("{\"title\": \"List\", \"items\": [{\"name\": \"a\"}, {\"name\": \"b", new(Output))
+
+		assert.NotNil(t, instance)
+		assert.Equal(t, "List", instance.(*Output).Title)
+		assert.Len(t, instance.(*Output).Items, 1)
+		assert.Equal(t, "a", instance.(*Output).Items[0].Name)
+	})
+
+	t.Run("ScalarArrayElements", func(t *testing.T) {
+		assert.Equal(t, "[1]", ContentPartial("[1, 23"))
+		assert.Equal(t, "[1, 23]", ContentPartial("[1, 23,"))
+	})
+
+	t.Run("NothingParsed", func(t *testing.T) {
+		instance, _ := OutputPartial("Thinking about", new(Output))
+
+		assert.Nil(t, instance)
+	})
+}
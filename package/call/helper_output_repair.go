@@ -0,0 +1,137 @@
+package call
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/bsthun/gut"
+)
+
+// OutputParse extracts json candidates from content and parses the first one that matches the output schema
+// and passes validation into output, it returns the candidate content that was parsed,
+// unclosed brackets are only closed when finish reason reports truncated output
+func OutputParse(content string, finishReason string, output any) (string, *gut.ErrorInstance) {
+	candidates := ContentExtract(content, finishReason)
+	if len(candidates) == 0 {
+		candidates = []string{content}
+	}
+	schema := SchemaConvert(output)
+
+	// * keep the error of the candidate that went furthest
+	var result string
+	var resultErr *gut.ErrorInstance
+	resultStage := -1
+	reject := func(candidate string, stage int, err *gut.ErrorInstance) {
+		if stage > resultStage {
+			result, resultErr, resultStage = candidate, err, stage
+		}
+	}
+
+	for _, candidate := range candidates {
+		// * decode candidate generically
+		var value any
+		if err := json.Unmarshal([]byte(candidate), &value); err != nil {
+			reject(candidate, 0, gut.Err(false, "failed to unmarshal response content to output: "+err.Error(), err))
+			continue
+		}
+
+		// * match against output schema
+		if !SchemaMatch(schema, value) {
+			reject(candidate, 1, gut.Err(false, "response content does not match output schema: "+OutputSchemaString(schema)))
+			continue
+		}
+
+		// * reset output to avoid leftovers from previous candidates
+		reflected := reflect.ValueOf(output)
+		if reflected.Kind() == reflect.Ptr && !reflected.IsNil() {
+			reflected.Elem().SetZero()
+		}
+
+		// * unmarshal candidate
+		if err := json.Unmarshal([]byte(candidate), output); err != nil {
+			reject(candidate, 2, gut.Err(false, "failed to unmarshal response content to output: "+err.Error(), err))
+			continue
+		}
+
+		// * validate output
+		if fieldErrors := OutputValidate(output); len(fieldErrors) > 0 {
+			reject(candidate, 3, gut.Err(false, "response content failed validation: "+strings.Join(fieldErrors, "; ")))
+			continue
+		}
+
+		return candidate, nil
+	}
+
+	return result, resultErr
+}
+
+// OutputSchemaString renders schema as json for error feedback
+func OutputSchemaString(schema *Schema) string {
+	content, err := json.Marshal(schema)
+	if err != nil {
+		return ""
+	}
+	return string(content)
+}
+
+// OutputRepair invokes the request and parses structured output into output,
+// when parsing or validation fails, the model is re-prompted with the exact errors until attempts are exhausted
+func OutputRepair(request *Request, option *Option, output any, invoke func(request *Request) (*Response, *gut.ErrorInstance)) (*Response, *gut.ErrorInstance) {
+	attempts := 1
+	if option.RepairAttempts != nil && *option.RepairAttempts > 1 {
+		attempts = *option.RepairAttempts
+	}
+
+	usage := &Usage{
+		InputTokens:  gut.Ptr[int64](0),
+		OutputTokens: gut.Ptr[int64](0),
+		CachedTokens: gut.Ptr[int64](0),
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := invoke(request)
+		if err != nil {
+			return nil, err
+		}
+
+		// * accumulate usage across attempts
+		if response.Message != nil && response.Message.Usage != nil {
+			*usage.InputTokens += gut.Val(response.Message.Usage.InputTokens)
+			*usage.OutputTokens += gut.Val(response.Message.Usage.OutputTokens)
+			*usage.CachedTokens += gut.Val(response.Message.Usage.CachedTokens)
+			if attempt > 1 {
+				response.Message.Usage = usage
+			}
+		}
+
+		// * skip parsing when there is no structured content to parse
+		if output == nil || response.Message == nil || response.Message.Content == nil || *response.Message.Content == "" || len(response.Message.ToolCalls) > 0 {
+			return response, nil
+		}
+
+		// * replace content with the parsed candidate only on success, keeping the model output otherwise
+		content, parseErr := OutputParse(*response.Message.Content, response.FinishReason, output)
+		if parseErr == nil {
+			*response.Message.Content = content
+			return response, nil
+		}
+
+		if attempt >= attempts {
+			return nil, parseErr
+		}
+		gut.Debug("structured output repair attempt", attempt, parseErr)
+
+		// * re-prompt with the failed response and its errors
+		repairRequest := *request
+		repairRequest.Messages = make([]Message, 0, len(request.Messages)+2)
+		repairRequest.Messages = append(repairRequest.Messages, request.Messages...)
+		repairRequest.Messages = append(repairRequest.Messages,
+			response.Message,
+			&UserMessage{
+				Content: gut.Ptr("Your previous response was rejected: " + parseErr.Error() + "\nRespond again with the corrected JSON only."),
+			},
+		)
+		request = &repairRequest
+	}
+}
@@ -0,0 +1,127 @@
+package call
+
+import (
+	"testing"
+
+	"github.com/bsthun/gut"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputValidate(t *testing.T) {
+	t.Run("ValidPerson", func(t *testing.T) {
+		output := &Person{
+			Name:   "John",
+			Emails: []string{"john@example.com"},
+			Address: &struct {
+				Street string `json:"street" validate:"required"`
+				City   string `json:"city" validate:"required"`
+			}{
+				Street: "Main",
+				City:   "Bangkok",
+			},
+		}
+
+		assert.Empty(t, OutputValidate(output))
+	})
+
+	t.Run("FieldErrors", func(t *testing.T) {
+		output := &Person{
+			Name:   "",
+			Emails: []string{"john@example.com", "invalid"},
+		}
+
+		fieldErrors := OutputValidate(output)
+		assert.Len(t, fieldErrors, 3)
+		assert.Contains(t, fieldErrors[0], "name")
+		assert.Contains(t, fieldErrors[1], "email[1]")
+		assert.Contains(t, fieldErrors[2], "address")
+	})
+
+	t.Run("ValidatorRules", func(t *testing.T) {
+		type Arguments struct {
+			Ids      []int  `json:"ids" validate:"required,min=1,dive,gt=0"`
+			Password string `json:"password" validate:"required"`
+			Confirm  string `json:"confirm" validate:"eqfield=Password"`
+			Count    int    `json:"count" validate:"required"`
+			Enabled  *bool  `json:"enabled" validate:"required"`
+		}
+
+		assert.Empty(t, OutputValidate(&Arguments{
+			Ids:      []int{1, 2},
+			Password: "secret",
+			Confirm:  "secret",
+			Count:    1,
+			Enabled:  gut.Ptr(false),
+		}))
+
+		fieldErrors := OutputValidate(&Arguments{
+			Ids:      []int{},
+			Password: "secret",
+			Confirm:  "other",
+		})
+		assert.Equal(t, []string{
+			"ids: failed on 'min=1' validation, got []",
+			"confirm: failed on 'eqfield=Password' validation, got other",
+			"count: field is required",
+			"enabled: field is required",
+		}, fieldErrors)
+		assert.Equal(t, []string{"ids[1]: failed on 'gt=0' validation, got 0"}, OutputValidate(&Arguments{
+			Ids:      []int{1, 0},
+			Password: "secret",
+			Confirm:  "secret",
+			Count:    1,
+			Enabled:  gut.Ptr(true),
+		}))
+	})
+}
+
+func TestOutputRepair(t *testing.T) {
+	t.Run("RepromptUntilValid", func(t *testing.T) {
+		contents := []string{
+			`{"name": "John", "email": ["invalid"], "address": {"street": "Main", "city": "Bangkok"}}`,
+			`{"name": "John", "email": ["john@example.com"], "address": {"street": "Main", "city": "Bangkok"}}`,
+		}
+		requests := make([]*Request, 0)
+		invoke := func(request *Request) (*Response, *gut.ErrorInstance) {
+			requests = append(requests, request)
+			return &Response{
+				Message: &AssistantMessage{
+					Content: gut.Ptr(contents[len(requests)-1]),
+				},
+			}, nil
+		}
+
+		output := new(Person)
+		response, err := OutputRepair(&Request{}, &Option{RepairAttempts: gut.Ptr(2)}, output, invoke)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, response)
+		assert.Len(t, requests, 2)
+		assert.Len(t, requests[1].Messages, 2)
+		assert.Contains(t, *requests[1].Messages[1].(*UserMessage).Content, "email[0]")
+		assert.Equal(t, "john@example.com", output.Emails[0])
+	})
+
+	t.Run("AttemptsExhausted", func(t *testing.T) {
+		original := "Here you go:\n```json\n{\"name\": \"\"}\n```"
+		messages := make([]*AssistantMessage, 0)
+		invoke := func(request *Request) (*Response, *gut.ErrorInstance) {
+			message := &AssistantMessage{
+				Content: gut.Ptr(original),
+			}
+			messages = append(messages, message)
+			return &Response{
+				Message: message,
+			}, nil
+		}
+
+		response, err := OutputRepair(&Request{}, &Option{RepairAttempts: gut.Ptr(2)}, new(Person), invoke)
+
+		assert.NotNil(t, err)
+		assert.Nil(t, response)
+		assert.Len(t, messages, 2)
+		for _, message := range messages {
+			assert.Equal(t, original, *message.Content)
+		}
+	})
+}
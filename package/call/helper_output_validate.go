@@ -0,0 +1,88 @@
+package call
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bsthun/gut"
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is the validator instance used for structured outputs and tool arguments,
+// field errors are named by json field names
+var Validator = OutputValidator()
+
+// OutputValidator creates a validator naming fields by their json tag
+func OutputValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return validate
+}
+
+// OutputValidate validates instance against its validate tags and returns every field error found with json paths,
+// tags follow validator semantics so slice elements are validated with dive
+func OutputValidate(instance any) []string {
+	if instance == nil {
+		return nil
+	}
+
+	// * validate structs only, other outputs have no validate tags
+	value := reflect.ValueOf(instance)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fieldErrors := make([]string, 0)
+	err := gut.Try(func() {
+		if err := Validator.Struct(value.Interface()); err != nil {
+			var validationErrors validator.ValidationErrors
+			if errors.As(err, &validationErrors) {
+				for _, fieldError := range validationErrors {
+					fieldErrors = append(fieldErrors, OutputValidateMessage(OutputValidateNamespace(fieldError.Namespace()), fieldError))
+				}
+				return
+			}
+			fieldErrors = append(fieldErrors, err.Error())
+		}
+	})
+	if err != nil {
+		fieldErrors = append(fieldErrors, "invalid validation rule: "+err.Error())
+	}
+	return fieldErrors
+}
+
+// OutputValidateNamespace converts a validator namespace to a json path by removing the root struct name
+func OutputValidateNamespace(namespace string) string {
+	if index := strings.Index(namespace, "."); index >= 0 {
+		return namespace[index+1:]
+	}
+	return namespace
+}
+
+// OutputValidateMessage formats a validator field error into a model-readable message
+func OutputValidateMessage(path string, fieldError validator.FieldError) string {
+	if fieldError.Tag() == "required" {
+		return fmt.Sprintf("%s: field is required", path)
+	}
+	if fieldError.Param() != "" {
+		return fmt.Sprintf("%s: failed on '%s=%s' validation, got %v", path, fieldError.Tag(), fieldError.Param(), fieldError.Value())
+	}
+	return fmt.Sprintf("%s: failed on '%s' validation, got %v", path, fieldError.Tag(), fieldError.Value())
+}
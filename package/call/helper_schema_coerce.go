@@ -0,0 +1,136 @@
+package call
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SchemaCoerce converts a decoded json value towards the types of schema,
+// it parses scalars from strings, stringifies scalars, wraps single values into arrays, decodes json encoded
+// objects and arrays from strings and drops properties unknown to a closed object schema declaring properties,
+// every applied change is described in the returned repairs with its json path
+func SchemaCoerce(schema *Schema, value any, path string) (any, []string) {
+	repairs := make([]string, 0)
+	if schema == nil || schema.Type == nil || value == nil {
+		return value, repairs
+	}
+	repair := func(format string, args ...any) {
+		repairs = append(repairs, SchemaCoercePath(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch *schema.Type {
+	case "object":
+		// * decode object encoded as string
+		if text, ok := value.(string); ok {
+			var decoded map[string]any
+			if SchemaCoerceDecode(text, &decoded) {
+				repair("decoded object from string")
+				value = decoded
+			}
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return value, repairs
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			item := object[key]
+			property, known := schema.Properties[key]
+			if !known {
+				if len(schema.Properties) > 0 && schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					repair("dropped unknown property %q", key)
+					delete(object, key)
+				}
+				continue
+			}
+			coerced, itemRepairs := SchemaCoerce(property, item, path+"."+key)
+			object[key] = coerced
+			repairs = append(repairs, itemRepairs...)
+		}
+		return object, repairs
+	case "array":
+		// * decode array encoded as string, otherwise wrap single value
+		if text, ok := value.(string); ok {
+			var decoded []any
+			if SchemaCoerceDecode(text, &decoded) {
+				repair("decoded array from string")
+				value = decoded
+			}
+		}
+		array, ok := value.([]any)
+		if !ok {
+			repair("wrapped single value into array")
+			array = []any{value}
+		}
+		for i, item := range array {
+			coerced, itemRepairs := SchemaCoerce(schema.Items, item, path+"["+strconv.Itoa(i)+"]")
+			array[i] = coerced
+			repairs = append(repairs, itemRepairs...)
+		}
+		return array, repairs
+	case "integer", "number":
+		switch v := value.(type) {
+		case string:
+			number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || (*schema.Type == "integer" && number != math.Trunc(number)) {
+				return value, repairs
+			}
+			repair("coerced string %q to %s", v, *schema.Type)
+			return json.Number(strings.TrimSpace(v)), repairs
+		case bool:
+			repair("coerced boolean to %s", *schema.Type)
+			if v {
+				return json.Number("1"), repairs
+			}
+			return json.Number("0"), repairs
+		}
+	case "boolean":
+		switch v := value.(type) {
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return value, repairs
+			}
+			repair("coerced string %q to boolean", v)
+			return parsed, repairs
+		case json.Number:
+			if v == "0" || v == "1" {
+				repair("coerced number %s to boolean", v)
+				return v == "1", repairs
+			}
+		}
+	case "string":
+		switch v := value.(type) {
+		case json.Number:
+			repair("coerced number %s to string", v)
+			return v.String(), repairs
+		case float64:
+			repair("coerced number to string")
+			return strconv.FormatFloat(v, 'f', -1, 64), repairs
+		case bool:
+			repair("coerced boolean to string")
+			return strconv.FormatBool(v), repairs
+		}
+	}
+
+	return value, repairs
+}
+
+// SchemaCoerceDecode decodes text as json into target preserving numbers, it reports whether decoding succeeded
+func SchemaCoerceDecode(text string, target any) bool {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	return decoder.Decode(target) == nil && !decoder.More()
+}
+
+// SchemaCoercePath renders a json path for repair descriptions, the root is rendered as $
+func SchemaCoercePath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return strings.TrimPrefix(path, ".")
+}
@@ -0,0 +1,97 @@
+package call
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaCoerce(t *testing.T) {
+	type Arguments struct {
+		Count   *int      `json:"count"`
+		Enabled *bool     `json:"enabled"`
+		Label   *string   `json:"label"`
+		Tags    []*string `json:"tags"`
+	}
+	schema := SchemaConvert(new(Arguments))
+
+	t.Run("Scalars", func(t *testing.T) {
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"count": "5", "enabled": "true", "label": 12, "tags": "urgent", "extra": 1}`, &value))
+
+		coerced, repairs := SchemaCoerce(schema, value, "")
+		content, _ := json.Marshal(coerced)
+
+		assert.JSONEq(t, `{"count": 5, "enabled": true, "label": "12", "tags": ["urgent"]}`, string(content))
+		assert.Len(t, repairs, 5)
+		assert.Contains(t, repairs, `count: coerced string "5" to number`)
+		assert.Contains(t, repairs, `tags: wrapped single value into array`)
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"count": 5, "tags": ["a"]}`, &value))
+
+		_, repairs := SchemaCoerce(schema, value, "")
+
+		assert.Empty(t, repairs)
+	})
+
+	t.Run("InvalidScalar", func(t *testing.T) {
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"count": "five"}`, &value))
+
+		coerced, repairs := SchemaCoerce(schema, value, "")
+
+		assert.Empty(t, repairs)
+		assert.Equal(t, "five", coerced.(map[string]any)["count"])
+	})
+
+	t.Run("OpenObject", func(t *testing.T) {
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"count": 5, "extra": 1}`, &value))
+		open := &Schema{Type: schema.Type, Properties: schema.Properties}
+
+		coerced, repairs := SchemaCoerce(open, value, "")
+
+		assert.Empty(t, repairs)
+		assert.Equal(t, json.Number("1"), coerced.(map[string]any)["extra"])
+	})
+
+	t.Run("MapArguments", func(t *testing.T) {
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"region": "eu", "limit": 5}`, &value))
+
+		coerced, repairs := SchemaCoerce(SchemaConvert(new(map[string]any)), value, "")
+
+		assert.Empty(t, repairs)
+		assert.Equal(t, map[string]any{"region": "eu", "limit": json.Number("5")}, coerced)
+	})
+
+	t.Run("StructMapField", func(t *testing.T) {
+		type Labelled struct {
+			Name   *string           `json:"name"`
+			Labels map[string]string `json:"labels"`
+		}
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"name": "api", "labels": {"team": "core", "tier": "1"}, "extra": 1}`, &value))
+
+		coerced, repairs := SchemaCoerce(SchemaConvert(new(Labelled)), value, "")
+		content, _ := json.Marshal(coerced)
+
+		assert.JSONEq(t, `{"name": "api", "labels": {"team": "core", "tier": "1"}}`, string(content))
+		assert.Equal(t, []string{`$: dropped unknown property "extra"`}, repairs)
+	})
+
+	t.Run("ClosedObjectWithoutProperties", func(t *testing.T) {
+		var value any
+		assert.True(t, SchemaCoerceDecode(`{"key": "value"}`, &value))
+		closed := &Schema{Type: schema.Type, AdditionalProperties: schema.AdditionalProperties}
+
+		coerced, repairs := SchemaCoerce(closed, value, "")
+
+		assert.Empty(t, repairs)
+		assert.Equal(t, map[string]any{"key": "value"}, coerced)
+	})
+}
@@ -1,7 +1,9 @@
 package call
 
 import (
+	"encoding/json"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/bsthun/gut"
@@ -24,13 +26,23 @@ func SchemaConvert(instance any) *Schema {
 	return SchemaConvertFromType(typ)
 }
 
-// SchemaConvertFromType converts a reflect.Type to a Schema representation.
+// SchemaConvertFromType converts a reflect.Type to a Schema representation,
+// metadata from SchemaDescriber implementations is merged into the resulting schema.
 func SchemaConvertFromType(typ reflect.Type) *Schema {
 	// * handle pointers
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
 
+	schema := SchemaConvertKind(typ)
+	SchemaMerge(schema, SchemaDescribe(typ))
+
+	return schema
+}
+
+// SchemaConvertKind converts a reflect.Type to a Schema representation by its kind.
+func SchemaConvertKind(typ reflect.Type) *Schema {
+
 	// * handle slices and arrays
 	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
 		return &Schema{
@@ -39,12 +51,12 @@ func SchemaConvertFromType(typ reflect.Type) *Schema {
 		}
 	}
 
-	// * handle maps
+	// * handle maps, keys are arbitrary so additional properties stay open
 	if typ.Kind() == reflect.Map {
 		return &Schema{
 			Type:                 gut.Ptr("object"),
 			Properties:           make(map[string]*Schema),
-			AdditionalProperties: gut.Ptr(false),
+			AdditionalProperties: gut.Ptr(true),
 		}
 	}
 
@@ -80,26 +92,12 @@ func SchemaConvertStructType(typ reflect.Type) *Schema {
 		}
 	}
 
-	// * get struct description from tag if available
-	var schemaDescription string
-	if typ.NumField() > 0 {
-		// * check for struct tag on first field (common pattern for struct-level metadata)
-		firstField := typ.Field(0)
-		if descTag := firstField.Tag.Get("description"); descTag != "" {
-			schemaDescription = descTag
-		}
-	}
-
 	schema := &Schema{
 		Type:                 gut.Ptr("object"),
 		Properties:           make(map[string]*Schema),
 		AdditionalProperties: gut.Ptr(false),
 	}
 
-	if schemaDescription != "" {
-		schema.Description = gut.Ptr(schemaDescription)
-	}
-
 	// * iterate through struct fields
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
@@ -126,10 +124,8 @@ func SchemaConvertStructType(typ reflect.Type) *Schema {
 		// * convert field type to schema
 		fieldSchema := SchemaConvertFromType(field.Type)
 
-		// * add field description from tag if available
-		if descTag := field.Tag.Get("description"); descTag != "" {
-			fieldSchema.Description = gut.Ptr(descTag)
-		}
+		// * add field metadata from tags if available
+		SchemaConvertFieldTag(field, fieldSchema)
 
 		schema.Properties[fieldName] = fieldSchema
 
@@ -145,3 +141,35 @@ func SchemaConvertStructType(typ reflect.Type) *Schema {
 
 	return schema
 }
+
+// SchemaConvertFieldTag applies description, title, example, default and deprecated tags of a field to its schema.
+func SchemaConvertFieldTag(field reflect.StructField, schema *Schema) {
+	if descTag := field.Tag.Get("description"); descTag != "" {
+		schema.Description = gut.Ptr(descTag)
+	}
+	if titleTag := field.Tag.Get("title"); titleTag != "" {
+		schema.Title = gut.Ptr(titleTag)
+	}
+	if exampleTag, ok := field.Tag.Lookup("example"); ok {
+		schema.Examples = []any{SchemaConvertTagValue(exampleTag)}
+	}
+	if defaultTag, ok := field.Tag.Lookup("default"); ok {
+		schema.Default = SchemaConvertTagValue(defaultTag)
+	}
+	if deprecatedTag := field.Tag.Get("deprecated"); deprecatedTag != "" {
+		deprecated, err := strconv.ParseBool(deprecatedTag)
+		if err != nil {
+			deprecated = true
+		}
+		schema.Deprecated = gut.Ptr(deprecated)
+	}
+}
+
+// SchemaConvertTagValue parses a tag value as json, falling back to the raw string.
+func SchemaConvertTagValue(tag string) any {
+	var value any
+	if err := json.Unmarshal([]byte(tag), &value); err != nil {
+		return tag
+	}
+	return value
+}
@@ -3,12 +3,13 @@ package call
 import (
 	"testing"
 
+	"github.com/bsthun/gut"
 	"github.com/stretchr/testify/assert"
 )
 
 type Person struct {
 	Name    string   `json:"name" description:"The name of the person" validate:"required"`
-	Emails  []string `json:"email" description:"The email address" validate:"required,email"`
+	Emails  []string `json:"email" description:"The email address" validate:"required,dive,email"`
 	Address *struct {
 		Street string `json:"street" validate:"required"`
 		City   string `json:"city" validate:"required"`
@@ -27,6 +28,24 @@ type FullPerson struct {
 	} `json:"address,omitempty"`
 }
 
+type DescribedPerson struct {
+	Name    string `json:"name" validate:"required" description:"The name of the person" title:"Name" example:"John"`
+	Age     int    `json:"age" default:"18"`
+	Country string `json:"country" deprecated:"true"`
+}
+
+func (r *DescribedPerson) SchemaDescribe() *Schema {
+	return &Schema{
+		Title:       gut.Ptr("Person"),
+		Description: gut.Ptr("A described person"),
+		Properties: map[string]*Schema{
+			"age": {
+				Description: gut.Ptr("The age in years"),
+			},
+		},
+	}
+}
+
 type PointerStruct struct {
 	Name   *string   `json:"name" validate:"required" description:"Pointer to string"`
 	Phones *[]string `json:"phones,omitempty" description:"Pointer to slice of strings"`
@@ -41,7 +60,7 @@ func TestSchemaConvert(t *testing.T) {
 
 		assert.NotNil(t, schema)
 		assert.Equal(t, "object", *schema.Type)
-		assert.Equal(t, "The name of the person", *schema.Description)
+		assert.Nil(t, schema.Description)
 
 		// * check required fields
 		if schema.Required != nil {
@@ -104,6 +123,19 @@ func TestSchemaConvert(t *testing.T) {
 		assert.Equal(t, 2, len(addressProp.Properties))
 	})
 
+	t.Run("DescribedStruct", func(t *testing.T) {
+		schema := SchemaConvert(new(DescribedPerson))
+
+		assert.Equal(t, "Person", *schema.Title)
+		assert.Equal(t, "A described person", *schema.Description)
+		assert.Equal(t, "The name of the person", *schema.Properties["name"].Description)
+		assert.Equal(t, "Name", *schema.Properties["name"].Title)
+		assert.Equal(t, []any{"John"}, schema.Properties["name"].Examples)
+		assert.Equal(t, 18.0, schema.Properties["age"].Default)
+		assert.Equal(t, "The age in years", *schema.Properties["age"].Description)
+		assert.True(t, *schema.Properties["country"].Deprecated)
+	})
+
 	t.Run("NilInput", func(t *testing.T) {
 		schema := SchemaConvert(nil)
 		assert.Nil(t, schema)
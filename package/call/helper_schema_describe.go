@@ -0,0 +1,58 @@
+package call
+
+import "reflect"
+
+// SchemaDescriber is implemented by types that annotate their own schema,
+// metadata keywords of the returned schema apply to the type, and entries of its properties apply to matching fields
+type SchemaDescriber interface {
+	SchemaDescribe() *Schema
+}
+
+var schemaDescriberType = reflect.TypeOf((*SchemaDescriber)(nil)).Elem()
+
+// SchemaDescribe returns schema metadata of typ when it or its pointer implements SchemaDescriber
+func SchemaDescribe(typ reflect.Type) *Schema {
+	if typ.Kind() == reflect.Interface {
+		return nil
+	}
+	if typ.Implements(schemaDescriberType) {
+		return reflect.Zero(typ).Interface().(SchemaDescriber).SchemaDescribe()
+	}
+	if reflect.PointerTo(typ).Implements(schemaDescriberType) {
+		return reflect.New(typ).Interface().(SchemaDescriber).SchemaDescribe()
+	}
+	return nil
+}
+
+// SchemaMerge copies metadata keywords of metadata into schema, recursing into properties that exist in both
+func SchemaMerge(schema *Schema, metadata *Schema) {
+	if schema == nil || metadata == nil {
+		return
+	}
+
+	if metadata.Title != nil {
+		schema.Title = metadata.Title
+	}
+	if metadata.Description != nil {
+		schema.Description = metadata.Description
+	}
+	if metadata.Format != nil {
+		schema.Format = metadata.Format
+	}
+	if len(metadata.Enum) > 0 {
+		schema.Enum = metadata.Enum
+	}
+	if len(metadata.Examples) > 0 {
+		schema.Examples = metadata.Examples
+	}
+	if metadata.Default != nil {
+		schema.Default = metadata.Default
+	}
+	if metadata.Deprecated != nil {
+		schema.Deprecated = metadata.Deprecated
+	}
+	for key, property := range metadata.Properties {
+		SchemaMerge(schema.Properties[key], property)
+	}
+	SchemaMerge(schema.Items, metadata.Items)
+}
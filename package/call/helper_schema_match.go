@@ -0,0 +1,56 @@
+package call
+
+import "math"
+
+// SchemaMatch reports whether a decoded json value conforms to the types and required properties of schema
+func SchemaMatch(schema *Schema, value any) bool {
+	if schema == nil || value == nil {
+		return true
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		if schema.Type != nil && *schema.Type != "object" {
+			return false
+		}
+		for _, required := range schema.Required {
+			if required == nil {
+				continue
+			}
+			if _, ok := value[*required]; !ok {
+				return false
+			}
+		}
+		for key, property := range schema.Properties {
+			if item, ok := value[key]; ok && !SchemaMatch(property, item) {
+				return false
+			}
+		}
+	case []any:
+		if schema.Type != nil && *schema.Type != "array" {
+			return false
+		}
+		for _, item := range value {
+			if !SchemaMatch(schema.Items, item) {
+				return false
+			}
+		}
+	case string:
+		if schema.Type != nil && *schema.Type != "string" {
+			return false
+		}
+	case float64:
+		if schema.Type != nil && *schema.Type != "number" && *schema.Type != "integer" {
+			return false
+		}
+		if schema.Type != nil && *schema.Type == "integer" && value != math.Trunc(value) {
+			return false
+		}
+	case bool:
+		if schema.Type != nil && *schema.Type != "boolean" {
+			return false
+		}
+	}
+
+	return true
+}
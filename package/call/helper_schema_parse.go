@@ -0,0 +1,180 @@
+package call
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/bsthun/gut"
+)
+
+// SchemaField maps a json schema keyword to a typed field index of Schema
+type SchemaField struct {
+	Keyword string
+	Index   int
+}
+
+var schemaFields = SchemaFieldsResolve()
+
+// SchemaFieldsResolve resolves json schema keywords of typed Schema fields
+func SchemaFieldsResolve() []*SchemaField {
+	fields := make([]*SchemaField, 0)
+	typ := reflect.TypeOf(Schema{})
+	for i := 0; i < typ.NumField(); i++ {
+		keyword := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if keyword == "" || keyword == "-" {
+			continue
+		}
+		fields = append(fields, &SchemaField{
+			Keyword: keyword,
+			Index:   i,
+		})
+	}
+	return fields
+}
+
+// SchemaParse parses an arbitrary json schema document into Schema without losing keywords
+func SchemaParse(document []byte) (*Schema, *gut.ErrorInstance) {
+	schema := new(Schema)
+	if err := json.Unmarshal(document, schema); err != nil {
+		return nil, gut.Err(false, "failed to parse json schema: "+err.Error(), err)
+	}
+	return schema, nil
+}
+
+// SchemaParseValue parses a decoded json schema value such as map[string]any into Schema
+func SchemaParseValue(value any) (*Schema, *gut.ErrorInstance) {
+	document, err := json.Marshal(value)
+	if err != nil {
+		return nil, gut.Err(false, "failed to marshal json schema value: "+err.Error(), err)
+	}
+	return SchemaParse(document)
+}
+
+// SchemaDocument converts Schema back into a json schema document including extension keywords
+func SchemaDocument(schema *Schema) ([]byte, *gut.ErrorInstance) {
+	document, err := json.Marshal(schema)
+	if err != nil {
+		return nil, gut.Err(false, "failed to marshal json schema: "+err.Error(), err)
+	}
+	return document, nil
+}
+
+// SchemaDocumentValue converts Schema into a generic map of json schema keywords
+func SchemaDocumentValue(schema *Schema) (map[string]any, *gut.ErrorInstance) {
+	document, err := SchemaDocument(schema)
+	if err != nil {
+		return nil, err
+	}
+	value := make(map[string]any)
+	if err := json.Unmarshal(document, &value); err != nil {
+		return nil, gut.Err(false, "failed to unmarshal json schema document: "+err.Error(), err)
+	}
+	return value, nil
+}
+
+// MarshalJSON writes typed keywords and extension keywords as a single json schema object
+func (r *Schema) MarshalJSON() ([]byte, error) {
+	document := make(map[string]any)
+	value := reflect.ValueOf(r).Elem()
+
+	for _, field := range schemaFields {
+		fieldValue := value.Field(field.Index)
+		switch fieldValue.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if fieldValue.IsNil() {
+				continue
+			}
+		case reflect.Slice, reflect.Map:
+			if fieldValue.Len() == 0 {
+				continue
+			}
+		default:
+		}
+		document[field.Keyword] = fieldValue.Interface()
+	}
+
+	for keyword, extension := range r.Extensions {
+		if _, ok := document[keyword]; !ok {
+			document[keyword] = extension
+		}
+	}
+
+	return json.Marshal(document)
+}
+
+// UnmarshalJSON reads json schema keywords into typed fields,
+// keywords that are unknown, explicitly null, empty or not representable by the typed field are kept in Extensions
+func (r *Schema) UnmarshalJSON(data []byte) error {
+	// * convert boolean schemas to their equivalent object form
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Equal(trimmed, []byte("true")) {
+		*r = Schema{}
+		return nil
+	}
+	if bytes.Equal(trimmed, []byte("false")) {
+		*r = Schema{Not: new(Schema)}
+		return nil
+	}
+
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = Schema{}
+	value := reflect.ValueOf(r).Elem()
+	known := make(map[string]bool)
+
+	for _, field := range schemaFields {
+		message, ok := raw[field.Keyword]
+		if !ok {
+			continue
+		}
+		known[field.Keyword] = true
+
+		// * decode into typed field, keep as extension when it does not fit
+		fieldValue := reflect.New(value.Field(field.Index).Type())
+		decoder := json.NewDecoder(bytes.NewReader(message))
+		decoder.UseNumber()
+		err := decoder.Decode(fieldValue.Interface())
+		decoded := fieldValue.Elem()
+		empty := err != nil
+		switch decoded.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			empty = empty || decoded.IsNil()
+		case reflect.Slice, reflect.Map:
+			empty = empty || decoded.Len() == 0
+		default:
+		}
+		if err == nil && !empty {
+			value.Field(field.Index).Set(decoded)
+			continue
+		}
+		r.SchemaExtensionSet(field.Keyword, message)
+	}
+
+	for keyword, message := range raw {
+		if known[keyword] {
+			continue
+		}
+		r.SchemaExtensionSet(keyword, message)
+	}
+
+	return nil
+}
+
+// SchemaExtensionSet stores a raw keyword value in Extensions
+func (r *Schema) SchemaExtensionSet(keyword string, message json.RawMessage) {
+	if r.Extensions == nil {
+		r.Extensions = make(map[string]any)
+	}
+	var extension any
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	if err := decoder.Decode(&extension); err != nil {
+		extension = message
+	}
+	r.Extensions[keyword] = extension
+}
@@ -0,0 +1,69 @@
+package call
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaParse(t *testing.T) {
+	document := `{
+		"type": "object",
+		"title": "Order",
+		"description": "An order",
+		"$defs": {
+			"item": {"type": "object", "properties": {"sku": {"type": "string", "pattern": "^[A-Z]+$"}}}
+		},
+		"properties": {
+			"id": {"type": ["string", "null"], "format": "uuid"},
+			"status": {"type": "string", "enum": ["open", "closed"], "default": "open"},
+			"priority": {"type": "integer", "enum": [1, 2, 3], "minimum": 1, "maximum": 3},
+			"items": {"type": "array", "items": {"$ref": "#/$defs/item"}, "minItems": 1},
+			"note": {"anyOf": [{"type": "string"}, {"type": "null"}], "default": null},
+			"metadata": {"type": "object", "additionalProperties": {"type": "string"}},
+			"tags": {"type": "array", "items": [{"type": "string"}], "x-order": 7}
+		},
+		"required": ["id", "items"],
+		"additionalProperties": false,
+		"patternProperties": {"^x-": {}}
+	}`
+
+	t.Run("TypedKeywords", func(t *testing.T) {
+		schema, err := SchemaParse([]byte(document))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Order", *schema.Title)
+		assert.Equal(t, "#/$defs/item", *schema.Properties["items"].Items.Ref)
+		assert.Equal(t, "string", *schema.Defs["item"].Properties["sku"].Type)
+		assert.Equal(t, 2, len(schema.Properties["note"].AnyOf))
+		assert.Equal(t, "open", *schema.Properties["status"].Enum[0])
+		assert.Equal(t, 3.0, *schema.Properties["priority"].Maximum)
+		assert.False(t, *schema.AdditionalProperties)
+	})
+
+	t.Run("ExtensionKeywords", func(t *testing.T) {
+		schema, err := SchemaParse([]byte(document))
+
+		assert.Nil(t, err)
+		assert.Nil(t, schema.Properties["id"].Type)
+		assert.Contains(t, schema.Properties["id"].Extensions, "type")
+		assert.Contains(t, schema.Properties["priority"].Extensions, "enum")
+		assert.Contains(t, schema.Properties["metadata"].Extensions, "additionalProperties")
+		assert.Contains(t, schema.Properties["note"].Extensions, "default")
+		assert.Contains(t, schema.Extensions, "patternProperties")
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		schema, err := SchemaParse([]byte(document))
+		assert.Nil(t, err)
+
+		output, err := SchemaDocument(schema)
+		assert.Nil(t, err)
+
+		var expected, actual any
+		assert.NoError(t, json.Unmarshal([]byte(document), &expected))
+		assert.NoError(t, json.Unmarshal(output, &actual))
+		assert.Equal(t, expected, actual)
+	})
+}
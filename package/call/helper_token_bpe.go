@@ -0,0 +1,214 @@
+package call
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bsthun/gut"
+)
+
+// TokenEncoding is the name of a byte pair encoding used by OpenAI models
+type TokenEncoding string
+
+const (
+	TokenEncodingCl100k TokenEncoding = "cl100k_base"
+	TokenEncodingO200k  TokenEncoding = "o200k_base"
+)
+
+// tokenWhitespace is the unicode white space class, go regexp \s only matches ascii white space
+const tokenWhitespace = `\s\x{0B}\x{85}\p{Z}`
+
+var tokenSplitPattern = map[TokenEncoding]*regexp.Regexp{
+	TokenEncodingCl100k: regexp.MustCompile(`^(?:(?i:'s|'t|'re|'ve|'m|'ll|'d)` +
+		`|[^\r\n\p{L}\p{N}]?\p{L}+` +
+		`|\p{N}{1,3}` +
+		`| ?[^` + tokenWhitespace + `\p{L}\p{N}]+[\r\n]*` +
+		`|[` + tokenWhitespace + `]*[\r\n]+` +
+		`|[` + tokenWhitespace + `]+)`),
+	TokenEncodingO200k: regexp.MustCompile(`^(?:[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}` +
+		`| ?[^` + tokenWhitespace + `\p{L}\p{N}]+[\r\n/]*` +
+		`|[` + tokenWhitespace + `]*[\r\n]+` +
+		`|[` + tokenWhitespace + `]+)`),
+}
+
+// TokenEncodingModel returns the encoding of an OpenAI model name, defaulting to o200k_base for unknown models
+func TokenEncodingModel(model string) TokenEncoding {
+	for _, prefix := range []string{"gpt-4-", "gpt-3.5", "text-embedding-3", "text-embedding-ada"} {
+		if strings.HasPrefix(model, prefix) {
+			return TokenEncodingCl100k
+		}
+	}
+	if model == "gpt-4" {
+		return TokenEncodingCl100k
+	}
+	return TokenEncodingO200k
+}
+
+// TokenSplit splits text into pieces with the pre-tokenization pattern of encoding before byte pair merging,
+// the white space lookahead of the original pattern is applied by leaving the last white space for the following word
+func TokenSplit(encoding TokenEncoding, text string) []string {
+	pattern, ok := tokenSplitPattern[encoding]
+	if !ok {
+		pattern = tokenSplitPattern[TokenEncodingO200k]
+	}
+
+	pieces := make([]string, 0)
+	for position := 0; position < len(text); {
+		length := 0
+		if match := pattern.FindStringIndex(text[position:]); match != nil {
+			length = match[1]
+		}
+		if length == 0 {
+			_, length = utf8.DecodeRuneInString(text[position:])
+		}
+
+		// * emulate \s+(?!\S) for white space runs followed by a word
+		piece := text[position : position+length]
+		if position+length < len(text) && TokenSpace(piece) && !strings.ContainsAny(piece, "\r\n") {
+			next, _ := utf8.DecodeRuneInString(text[position+length:])
+			_, last := utf8.DecodeLastRuneInString(piece)
+			if !unicode.IsSpace(next) && last < length {
+				length -= last
+			}
+		}
+
+		pieces = append(pieces, text[position:position+length])
+		position += length
+	}
+	return pieces
+}
+
+// TokenSpace reports whether text only contains white space
+func TokenSpace(text string) bool {
+	for _, character := range text {
+		if !unicode.IsSpace(character) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenizerBpe is an offline byte pair encoding tokenizer compatible with tiktoken rank files of OpenAI encodings,
+// no ranks are bundled so it is created from a rank file such as https://openaipublic.blob.core.windows.net/encodings/o200k_base.tiktoken
+type TokenizerBpe struct {
+	Encoding TokenEncoding
+	Ranks    map[string]int
+}
+
+// NewTokenizerBpe reads a tiktoken rank file, where each line is a base64 token followed by its rank
+func NewTokenizerBpe(encoding TokenEncoding, ranks io.Reader) (*TokenizerBpe, *gut.ErrorInstance) {
+	tokenizer := &TokenizerBpe{
+		Encoding: encoding,
+		Ranks:    make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(ranks)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, gut.Err(false, "invalid rank line: "+line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, gut.Err(false, "invalid rank token: "+fields[0], err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, gut.Err(false, "invalid rank: "+fields[1], err)
+		}
+		tokenizer.Ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, gut.Err(false, "failed to read ranks", err)
+	}
+	if len(tokenizer.Ranks) == 0 {
+		return nil, gut.Err(false, "no ranks for encoding "+string(encoding))
+	}
+
+	return tokenizer, nil
+}
+
+// NewTokenizerBpeFile reads a tiktoken rank file such as o200k_base.tiktoken from path
+func NewTokenizerBpeFile(encoding TokenEncoding, path string) (*TokenizerBpe, *gut.ErrorInstance) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, gut.Err(false, "failed to open rank file", err)
+	}
+	defer file.Close()
+	return NewTokenizerBpe(encoding, file)
+}
+
+// TokenizerCheck returns an error for a tokenizer unable to count tokens, such as a bpe tokenizer without ranks
+func TokenizerCheck(tokenizer Tokenizer) *gut.ErrorInstance {
+	if bpe, ok := tokenizer.(*TokenizerBpe); ok && len(bpe.Ranks) == 0 {
+		return gut.Err(false, "bpe tokenizer has no ranks, create it from a rank file with NewTokenizerBpeFile")
+	}
+	return nil
+}
+
+// Encode returns token ranks of text, bytes missing from the ranks are encoded as -1
+func (r *TokenizerBpe) Encode(text string) []int {
+	tokens := make([]int, 0)
+	for _, piece := range TokenSplit(r.Encoding, text) {
+		tokens = append(tokens, r.Merge(piece)...)
+	}
+	return tokens
+}
+
+func (r *TokenizerBpe) Count(text string) int {
+	return len(r.Encode(text))
+}
+
+// Merge applies byte pair merges to a piece, always merging the leftmost adjacent pair of lowest rank
+func (r *TokenizerBpe) Merge(piece string) []int {
+	if rank, ok := r.Ranks[piece]; ok {
+		return []int{rank}
+	}
+
+	// * start from single bytes
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+
+	// * merge pairs until no adjacent pair has a rank
+	for len(parts) > 1 {
+		best := -1
+		bestRank := math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := r.Ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best = i
+				bestRank = rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] = parts[best] + parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+
+	tokens := make([]int, len(parts))
+	for i, part := range parts {
+		rank, ok := r.Ranks[part]
+		if !ok {
+			rank = -1
+		}
+		tokens[i] = rank
+	}
+	return tokens
+}
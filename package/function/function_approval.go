@@ -0,0 +1,80 @@
+package function
+
+import (
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+type ApprovalDecision string
+
+const (
+	ApprovalDecisionApproved ApprovalDecision = "approved"
+	ApprovalDecisionRejected ApprovalDecision = "rejected"
+)
+
+// FinishReasonSuspended is the finish reason of responses returned while tool calls are waiting for approval
+const FinishReasonSuspended = "suspended"
+
+// Approval holds a human decision on a pending tool call, arguments replace the tool call arguments when set
+type Approval struct {
+	// Decision runs the tool only when approved, decisions other than approved or rejected are errors
+	Decision  ApprovalDecision `json:"decision"`
+	Arguments []byte           `json:"arguments"`
+	Reason    *string          `json:"reason"`
+}
+
+// Approve approves a pending tool call, optionally replacing its arguments with edited json arguments
+func (r *State) Approve(toolCallId string, arguments []byte) *gut.ErrorInstance {
+	return r.ApprovalSet(toolCallId, &Approval{
+		Decision:  ApprovalDecisionApproved,
+		Arguments: arguments,
+	})
+}
+
+// Reject rejects a pending tool call, the reason is reported to the model as the tool call error
+func (r *State) Reject(toolCallId string, reason *string) *gut.ErrorInstance {
+	return r.ApprovalSet(toolCallId, &Approval{
+		Decision: ApprovalDecisionRejected,
+		Reason:   reason,
+	})
+}
+
+// ApprovalSet records an approval decision for a pending tool call
+func (r *State) ApprovalSet(toolCallId string, approval *Approval) *gut.ErrorInstance {
+	found := false
+	for _, toolCall := range r.PendingToolCalls() {
+		if gut.Val(toolCall.Id) == toolCallId {
+			found = true
+		}
+	}
+	if !found {
+		return gut.Err(false, "no pending tool call: "+toolCallId)
+	}
+	if approval.Decision != ApprovalDecisionApproved && approval.Decision != ApprovalDecisionRejected {
+		return gut.Err(false, "unknown approval decision: "+string(approval.Decision))
+	}
+	if r.Approvals == nil {
+		r.Approvals = make(map[string]*Approval)
+	}
+	r.Approvals[toolCallId] = approval
+	return nil
+}
+
+// PendingToolCalls returns tool calls of the suspended turn that are not executed yet
+func (r *State) PendingToolCalls() []*call.ToolCall {
+	pending := make([]*call.ToolCall, 0)
+	if r.Pending == nil {
+		return pending
+	}
+	for _, toolCall := range r.Pending.ToolCalls {
+		if toolCall.Result == nil && toolCall.Error == nil {
+			pending = append(pending, toolCall)
+		}
+	}
+	return pending
+}
+
+// Suspended reports whether the state is waiting for approval decisions or was interrupted before completing a turn
+func (r *State) Suspended() bool {
+	return r.Pending != nil
+}
@@ -0,0 +1,105 @@
+package function
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bsthun/gut"
+)
+
+// ArtifactStore stores oversized tool results for the model to page through with the read_artifact tool
+type ArtifactStore interface {
+	// Put stores content and returns its artifact id
+	Put(name *string, content []byte) (*string, *gut.ErrorInstance)
+	// Get returns content of an artifact by id
+	Get(id *string) ([]byte, *gut.ErrorInstance)
+}
+
+// ArtifactMemory is an in-memory artifact store scoped to the process
+type ArtifactMemory struct {
+	mutex     sync.Mutex
+	artifacts map[string][]byte
+	sequence  int
+}
+
+func NewArtifactMemory() *ArtifactMemory {
+	return &ArtifactMemory{
+		artifacts: make(map[string][]byte),
+	}
+}
+
+func (r *ArtifactMemory) Put(name *string, content []byte) (*string, *gut.ErrorInstance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sequence++
+	id := gut.Val(name, "artifact") + "_" + strconv.Itoa(r.sequence)
+	r.artifacts[id] = content
+	return &id, nil
+}
+
+func (r *ArtifactMemory) Get(id *string) ([]byte, *gut.ErrorInstance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	content, ok := r.artifacts[gut.Val(id)]
+	if !ok {
+		return nil, gut.Err(false, "artifact not found: "+gut.Val(id))
+	}
+	return content, nil
+}
+
+// ArtifactReadArguments pages through an artifact by byte offset
+type ArtifactReadArguments struct {
+	Id     *string `json:"id" validate:"required" description:"Artifact id returned in the truncated tool result"`
+	Offset *int    `json:"offset" description:"Byte offset to start reading from, defaults to 0"`
+	Length *int    `json:"length" description:"Number of bytes to read, defaults to the result limit"`
+}
+
+// NewArtifactReader creates the built-in read_artifact declaration reading pages of length bytes at most from store
+func NewArtifactReader(store ArtifactStore, length int) *Declaration {
+	declaration := NewDeclarationResult(
+		gut.Ptr("read_artifact"),
+		gut.Ptr("Read a page of a stored tool result artifact that was too large to return at once"),
+		func(ctx *DeclarationContext, arguments *ArtifactReadArguments) (map[string]any, *gut.ErrorInstance) {
+			content, err := store.Get(arguments.Id)
+			if err != nil {
+				return nil, err
+			}
+
+			// * clamp page to artifact bounds and rune boundaries
+			offset := ArtifactBoundary(content, min(max(gut.Val(arguments.Offset), 0), len(content)))
+			size := gut.Val(arguments.Length, length)
+			if size <= 0 || size > length {
+				size = length
+			}
+			end := ArtifactBoundary(content, min(offset+size, len(content)))
+			if end == offset && end < len(content) {
+				_, width := utf8.DecodeRune(content[end:])
+				end += width
+			}
+
+			return map[string]any{
+				"id":      *arguments.Id,
+				"content": string(content[offset:end]),
+				"offset":  offset,
+				"next":    end,
+				"total":   len(content),
+				"done":    end >= len(content),
+			}, nil
+		},
+	)
+
+	// * pages are already bounded by length, escaping overhead must not be limited again
+	declaration.ResultLimit = gut.Ptr(math.MaxInt)
+
+	return declaration
+}
+
+// ArtifactBoundary moves a byte offset back to the start of the rune containing it, so pages never split utf-8 characters
+func ArtifactBoundary(content []byte, offset int) int {
+	for offset > 0 && offset < len(content) && !utf8.RuneStart(content[offset]) {
+		offset--
+	}
+	return offset
+}
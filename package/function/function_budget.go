@@ -0,0 +1,123 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+type BudgetLimit string
+
+const (
+	BudgetLimitTurns     BudgetLimit = "turns"
+	BudgetLimitTokens    BudgetLimit = "tokens"
+	BudgetLimitToolCalls BudgetLimit = "toolCalls"
+	BudgetLimitDuration  BudgetLimit = "duration"
+)
+
+// BudgetErrorCode is the error code of function calling loop errors caused by reaching a budget limit
+const BudgetErrorCode = "budget_exceeded"
+
+// BudgetError reports that the function calling loop ended after reaching a budget limit,
+// response holds the final summary response when summary is enabled in option
+type BudgetError struct {
+	Limit    BudgetLimit    `json:"limit"`
+	Response *call.Response `json:"response"`
+}
+
+func (r *BudgetError) Error() string {
+	return "function calling budget exceeded: " + string(r.Limit)
+}
+
+// BudgetErrorOf returns the budget error carried by err, or nil if err is not caused by a budget limit
+func BudgetErrorOf(err *gut.ErrorInstance) *BudgetError {
+	if err == nil {
+		return nil
+	}
+	for _, block := range err.Errors {
+		var budgetError *BudgetError
+		if block.Err != nil && errors.As(block.Err, &budgetError) {
+			return budgetError
+		}
+	}
+	return nil
+}
+
+// Budget tracks resources spent by the function calling loop of a state, it is kept in the state
+// so limits hold across approval and checkpoint resumes, elapsed accumulates the duration of previous runs
+type Budget struct {
+	Turns     int           `json:"turns"`
+	Tokens    int64         `json:"tokens"`
+	ToolCalls int           `json:"toolCalls"`
+	Elapsed   time.Duration `json:"elapsed"`
+	startedAt time.Time
+}
+
+// NewBudget starts tracking a function calling loop
+func NewBudget() *Budget {
+	return &Budget{
+		startedAt: time.Now(),
+	}
+}
+
+// MarshalJSON writes the budget with the duration of the running run included in elapsed
+func (r *Budget) MarshalJSON() ([]byte, error) {
+	type budget Budget
+	spent := *r
+	spent.Elapsed = r.Spent()
+	return json.Marshal((*budget)(&spent))
+}
+
+// Start times a run of the loop, duration of previous runs is kept in elapsed
+func (r *Budget) Start() {
+	r.startedAt = time.Now()
+}
+
+// Stop adds the duration of the running run to elapsed
+func (r *Budget) Stop() {
+	r.Elapsed = r.Spent()
+	r.startedAt = time.Time{}
+}
+
+// Spent returns the duration spent by previous runs and the running run
+func (r *Budget) Spent() time.Duration {
+	if r.startedAt.IsZero() {
+		return r.Elapsed
+	}
+	return r.Elapsed + time.Since(r.startedAt)
+}
+
+// Consume records a model turn with its usage
+func (r *Budget) Consume(usage *call.Usage) {
+	r.Turns++
+	r.Spend(usage)
+}
+
+// Spend records usage of a model call without counting a turn, such as summary and compaction calls
+func (r *Budget) Spend(usage *call.Usage) {
+	if usage != nil {
+		r.Tokens += gut.Val(usage.InputTokens) + gut.Val(usage.OutputTokens)
+	}
+}
+
+// Exceeded returns the turn, token or duration limit of option reached before another model turn, or an empty limit
+func (r *Budget) Exceeded(option *Option) BudgetLimit {
+	if option.MaxTurns != nil && r.Turns >= *option.MaxTurns {
+		return BudgetLimitTurns
+	}
+	if option.MaxTotalTokens != nil && r.Tokens >= *option.MaxTotalTokens {
+		return BudgetLimitTokens
+	}
+	if option.MaxDuration != nil && r.Spent() >= *option.MaxDuration {
+		return BudgetLimitDuration
+	}
+	return ""
+}
+
+// ExceededToolCalls reports whether executing count more tool calls would pass the tool call limit of option
+func (r *Budget) ExceededToolCalls(option *Option, count int) bool {
+	return option.MaxToolCalls != nil && r.ToolCalls+count > *option.MaxToolCalls
+}
@@ -0,0 +1,121 @@
+package function
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bsthun/gut"
+	"github.com/stretchr/testify/assert"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+func TestCallBudget(t *testing.T) {
+	newCall := func(option *Option) (*Call, *CallerStub) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				if len(request.Tools) == 0 {
+					return CallerStubTextResponse("summary")
+				}
+				return CallerStubToolResponse("1", "ping", "{}")
+			},
+		}
+		functionCall := New(caller, option).(*Call)
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr("ping"),
+			gut.Ptr("Ping"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				return map[string]any{"pong": true}, nil
+			},
+		))
+		return functionCall, caller
+	}
+
+	t.Run("MaxTurns", func(t *testing.T) {
+		functionCall, caller := newCall(&Option{MaxTurns: gut.Ptr(3)})
+
+		response, err := functionCall.Call(NewState(nil), nil)
+
+		assert.Nil(t, response)
+		assert.NotNil(t, BudgetErrorOf(err))
+		assert.Equal(t, BudgetLimitTurns, BudgetErrorOf(err).Limit)
+		assert.Len(t, caller.Requests, 3)
+	})
+
+	t.Run("MaxToolCalls", func(t *testing.T) {
+		functionCall, _ := newCall(&Option{MaxToolCalls: gut.Ptr(2)})
+		state := NewState(nil)
+
+		_, err := functionCall.Call(state, nil)
+
+		assert.Equal(t, BudgetLimitToolCalls, BudgetErrorOf(err).Limit)
+		assert.Len(t, state.ToolMessages, 2)
+	})
+
+	t.Run("MaxTotalTokens", func(t *testing.T) {
+		functionCall, caller := newCall(&Option{MaxTotalTokens: gut.Ptr[int64](30)})
+
+		_, err := functionCall.Call(NewState(nil), nil)
+
+		assert.Equal(t, BudgetLimitTokens, BudgetErrorOf(err).Limit)
+		assert.Len(t, caller.Requests, 2)
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		functionCall, caller := newCall(&Option{MaxTurns: gut.Ptr(1), BudgetSummary: gut.Ptr(true)})
+
+		_, err := functionCall.Call(NewState(nil), nil)
+
+		budgetError := BudgetErrorOf(err)
+		assert.NotNil(t, budgetError)
+		assert.Equal(t, "summary", *budgetError.Response.Message.Content)
+		assert.Len(t, caller.Requests, 2)
+		assert.Nil(t, caller.Requests[1].Tools)
+	})
+
+	t.Run("SpentAcrossRuns", func(t *testing.T) {
+		functionCall, caller := newCall(&Option{MaxTurns: gut.Ptr(2)})
+		state := NewState(nil)
+
+		_, err := functionCall.Call(state, nil)
+		assert.Equal(t, BudgetLimitTurns, BudgetErrorOf(err).Limit)
+		_, err = functionCall.Call(state, nil)
+
+		assert.Equal(t, BudgetLimitTurns, BudgetErrorOf(err).Limit)
+		assert.Len(t, caller.Requests, 2)
+		assert.Equal(t, 2, state.Budget.Turns)
+	})
+
+	t.Run("MaxDurationDeadline", func(t *testing.T) {
+		functionCall, _ := newCall(&Option{MaxDuration: gut.Ptr(50 * time.Millisecond)})
+		functionCall.Declarations = nil
+		functionCall.AddDeclaration(NewDeclarationContext(
+			gut.Ptr("ping"),
+			gut.Ptr("Ping"),
+			func(ctx *DeclarationContext, arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				<-ctx.Done()
+				return nil, nil
+			},
+		))
+		started := time.Now()
+
+		_, err := functionCall.Call(NewState(nil), nil)
+
+		assert.Equal(t, BudgetLimitDuration, BudgetErrorOf(err).Limit)
+		assert.Less(t, time.Since(started), time.Second)
+	})
+
+	t.Run("SecondaryCalls", func(t *testing.T) {
+		functionCall, _ := newCall(&Option{
+			MaxTurns:           gut.Ptr(1),
+			ToolResultLimit:    gut.Ptr(4),
+			ToolResultOverflow: gut.Ptr(ResultOverflowSummary),
+		})
+		state := NewState(nil)
+
+		_, err := functionCall.Call(state, nil)
+
+		assert.Equal(t, BudgetLimitTurns, BudgetErrorOf(err).Limit)
+		assert.Equal(t, 1, state.Budget.Turns)
+		assert.Equal(t, int64(30), state.Budget.Tokens)
+	})
+}
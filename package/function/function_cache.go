@@ -0,0 +1,151 @@
+package function
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// DeclarationCacheKey derives the cache key of a cacheable declaration from its parsed arguments
+type DeclarationCacheKey func(arguments any) *string
+
+// CacheEntry is a memoised tool result, an entry without expiry never expires
+type CacheEntry struct {
+	Result    []byte              `json:"result"`
+	Parts     []*call.ContentPart `json:"parts"`
+	ExpiresAt *time.Time          `json:"expiresAt"`
+}
+
+// Expired reports whether the entry is past its expiry at now
+func (r *CacheEntry) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// CacheStore shares memoised tool results across runs
+type CacheStore interface {
+	// Get returns the entry of key, or nil when missing
+	Get(key string) (*CacheEntry, *gut.ErrorInstance)
+	// Put stores the entry of key
+	Put(key string, entry *CacheEntry) *gut.ErrorInstance
+}
+
+// CacheMemory is an in-memory cache store scoped to the process
+type CacheMemory struct {
+	mutex   sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+func NewCacheMemory() *CacheMemory {
+	return &CacheMemory{
+		entries: make(map[string]*CacheEntry),
+	}
+}
+
+func (r *CacheMemory) Get(key string) (*CacheEntry, *gut.ErrorInstance) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry, ok := r.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if entry.Expired(time.Now()) {
+		delete(r.entries, key)
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func (r *CacheMemory) Put(key string, entry *CacheEntry) *gut.ErrorInstance {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries[key] = entry
+	return nil
+}
+
+// CacheKey returns the cache key of a tool call to a cacheable declaration, or nil when the declaration is not cacheable,
+// keys are prefixed with the declaration name and default to the canonical json of parsed arguments
+func (r *Call) CacheKey(declaration *Declaration, arguments any) *string {
+	if declaration.Cache == nil || !*declaration.Cache {
+		return nil
+	}
+	if declaration.CacheKey != nil {
+		key := declaration.CacheKey(arguments)
+		if key == nil {
+			return nil
+		}
+		return gut.Ptr(gut.Val(declaration.Name) + ":" + *key)
+	}
+	content, err := json.Marshal(arguments)
+	if err != nil {
+		return nil
+	}
+	return gut.Ptr(gut.Val(declaration.Name) + ":" + string(content))
+}
+
+// CacheGet looks up key in the state cache, then in the option cache store, returning nil on miss
+func (r *Call) CacheGet(state *State, key *string) *CacheEntry {
+	if key == nil {
+		return nil
+	}
+	now := time.Now()
+
+	state.mutex.Lock()
+	entry := state.Cache[*key]
+	state.mutex.Unlock()
+	if entry != nil && !entry.Expired(now) {
+		return entry
+	}
+
+	if r.Option.CacheStore == nil {
+		return nil
+	}
+	entry, err := r.Option.CacheStore.Get(*key)
+	if err != nil {
+		gut.Debug("tool cache store lookup failed", err)
+		return nil
+	}
+	if entry == nil || entry.Expired(now) {
+		return nil
+	}
+
+	// * keep shared entry in state for following calls of this run
+	state.mutex.Lock()
+	if state.Cache == nil {
+		state.Cache = make(map[string]*CacheEntry)
+	}
+	state.Cache[*key] = entry
+	state.mutex.Unlock()
+
+	return entry
+}
+
+// CachePut stores a tool result under key in the state cache and the option cache store with the declaration ttl
+func (r *Call) CachePut(state *State, declaration *Declaration, key *string, result []byte, parts []*call.ContentPart) {
+	if key == nil {
+		return
+	}
+	entry := &CacheEntry{
+		Result:    result,
+		Parts:     parts,
+		ExpiresAt: nil,
+	}
+	if declaration.CacheTtl != nil {
+		entry.ExpiresAt = gut.Ptr(time.Now().Add(*declaration.CacheTtl))
+	}
+
+	state.mutex.Lock()
+	if state.Cache == nil {
+		state.Cache = make(map[string]*CacheEntry)
+	}
+	state.Cache[*key] = entry
+	state.mutex.Unlock()
+
+	if r.Option.CacheStore != nil {
+		if err := r.Option.CacheStore.Put(*key, entry); err != nil {
+			gut.Debug("tool cache store put failed", err)
+		}
+	}
+}
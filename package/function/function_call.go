@@ -3,9 +3,14 @@
 package function
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/bsthun/gut"
 	"go.scnd.dev/open/model/agentic/package/call"
@@ -23,6 +28,8 @@ type Call struct {
 	Caller       call.Caller    `json:"-"`
 	Option       *Option        `json:"option"`
 	Declarations []*Declaration `json:"declarations"`
+	builtins     map[string]*Declaration
+	builtinMutex sync.Mutex
 }
 
 func New(caller call.Caller, option *Option) Caller {
@@ -41,8 +48,94 @@ func (r *Call) AddDeclaration(declaration *Declaration) {
 // Call executes the function calling loop with state management and callbacks
 // during execution, state passed can use to get current messages and set callbacks
 func (r *Call) Call(state *State, output any) (*call.Response, *gut.ErrorInstance) {
-	// * convert function request to call request by appending function declarations as tools
-	callRequest := &call.Request{
+	response, err := r.Run(state, output)
+
+	// * invoke lifecycle hooks of loop end
+	if state.mutex == nil {
+		state.mutex = new(sync.Mutex)
+	}
+	if err != nil {
+		if state.OnError != nil {
+			state.mutex.Lock()
+			state.OnError(state, err)
+			state.mutex.Unlock()
+		}
+		return nil, err
+	}
+	if state.OnEnd != nil {
+		state.mutex.Lock()
+		state.OnEnd(state, response)
+		state.mutex.Unlock()
+	}
+
+	return response, nil
+}
+
+// Run executes the function calling loop until the model answers without tool calls, a terminator is called,
+// tool calls are suspended for approval or an error occurs, the checkpoint of a completed run is deleted
+func (r *Call) Run(state *State, output any) (*call.Response, *gut.ErrorInstance) {
+	// * ensure callback mutex for concurrent tool calls
+	if state.mutex == nil {
+		state.mutex = new(sync.Mutex)
+	}
+
+	// * reject compaction option without its required context window
+	if fieldErrors := call.OutputValidate(r.Option.Compaction); len(fieldErrors) > 0 {
+		return nil, gut.Err(false, "invalid compaction option: "+strings.Join(fieldErrors, "; "))
+	}
+
+	// * restore fresh state from its last checkpoint
+	if err := r.Restore(state); err != nil {
+		return nil, err
+	}
+
+	// * continue budget spent by previous runs of the state
+	if state.Budget == nil {
+		state.Budget = NewBudget()
+	}
+	state.Budget.Start()
+	defer state.Budget.Stop()
+
+	response, err := r.Bound(state, output)
+	if err != nil {
+		return nil, err
+	}
+
+	// * remove checkpoint of a completed run so a rerun with the same id starts over
+	if response.FinishReason != FinishReasonSuspended {
+		if err := r.Complete(state); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// Bound runs turns of the loop bounded by the remaining max duration as a context deadline,
+// reaching the deadline ends the loop with a duration BudgetError
+func (r *Call) Bound(state *State, output any) (*call.Response, *gut.ErrorInstance) {
+	if r.Option.MaxDuration == nil {
+		return r.Turns(state, output)
+	}
+	parent := state.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, *r.Option.MaxDuration-state.Budget.Spent())
+	defer cancel()
+	original := state.Context
+	state.Context = ctx
+	response, err := r.Turns(state, output)
+	state.Context = original
+	if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		gut.Debug("function calling deadline exceeded", err)
+		return r.BudgetEnd(state, r.Request(), output, BudgetLimitDuration)
+	}
+	return response, err
+}
+
+// Request returns a new call request with generation parameters of option, tools and messages are set per turn
+func (r *Call) Request() *call.Request {
+	return &call.Request{
 		Model:           r.Option.Model,
 		MaxTokens:       r.Option.MaxTokens,
 		Temperature:     r.Option.Temperature,
@@ -50,154 +143,181 @@ func (r *Call) Call(state *State, output any) (*call.Response, *gut.ErrorInstanc
 		TopK:            r.Option.TopK,
 		ReasoningEffort: r.Option.ReasoningEffort,
 		Messages:        nil,
-		Tools:           r.Tools(),
+		Tools:           nil,
+	}
+}
+
+// Turns runs model turns and tool calls of the function calling loop on state
+func (r *Call) Turns(state *State, output any) (*call.Response, *gut.ErrorInstance) {
+	// * leave structured output to terminator arguments when a terminator is declared
+	structured := output
+	if r.Terminator() != nil {
+		structured = nil
 	}
 
-	// * loop until no more tool calls
+	// * loop until no more tool calls or a budget limit is reached
+	budget := state.Budget
+	loop := NewLoop()
+	var nudge call.Message
+	var loopToolChoice *call.ToolChoice
+	var answer *call.AssistantMessage
+	reprompted := false
 	for {
-		// * call underlying caller
-		callRequest.Messages = state.Messages()
-		response, err := r.Caller.Call(callRequest, r.Option.CallOption, output)
-		if err != nil {
-			return nil, err
+		// * stop when state context is done
+		if state.Context != nil && state.Context.Err() != nil {
+			return nil, gut.Err(false, "function calling cancelled", state.Context.Err())
 		}
 
-		// * check if there are tool calls
-		if response.FinishReason != "tool_calls" && len(response.Message.ToolCalls) == 0 {
-			// * append final message
-			callRequest.Messages = append(callRequest.Messages, response.Message)
+		var response *call.Response
+		if state.Pending != nil {
+			// * resume tool calls suspended for approval without calling model
+			response = &call.Response{
+				FinishReason: "tool_calls",
+				Message:      state.Pending,
+			}
+		} else {
+			// * build call request of this turn so hook changes never carry over to later turns
+			callRequest := r.Request()
 
-			// * construct usage field
-			response.TotalUsage = &call.Usage{
-				InputTokens:  gut.Ptr[int64](0),
-				OutputTokens: gut.Ptr[int64](0),
-				CachedTokens: gut.Ptr[int64](0),
+			// * check budget before calling model
+			if limit := budget.Exceeded(r.Option); limit != "" {
+				return r.BudgetEnd(state, callRequest, output, limit)
 			}
 
-			// * aggregate usage from all messages
-			for _, message := range callRequest.Messages {
-				m, ok := message.(*call.AssistantMessage)
-				if !ok {
-					continue
-				}
-				if m.Usage == nil {
-					continue
+			// * invoke turn start hook
+			if state.OnTurnStart != nil {
+				state.mutex.Lock()
+				err := state.OnTurnStart(state, budget.Turns)
+				state.mutex.Unlock()
+				if err != nil {
+					return nil, err
 				}
-				*response.TotalUsage.InputTokens += gut.Val(m.Usage.InputTokens)
-				*response.TotalUsage.OutputTokens += gut.Val(m.Usage.OutputTokens)
-				*response.TotalUsage.CachedTokens += gut.Val(m.Usage.CachedTokens)
 			}
 
-			return response, nil
-		}
+			// * select tools exposed on this turn
+			callRequest.Tools = r.Select(state, budget.Turns)
 
-		// * process each tool call
-		toolCalls := make([]*call.ToolCall, 0)
-		for _, toolCall := range response.Message.ToolCalls {
-			// * find matching declaration
-			declaration := r.GetDeclaration(toolCall.Name)
-			if declaration == nil {
-				if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
-					return nil, gut.Err(false, "declaration not found for tool: "+gut.Val(toolCall.Name), nil)
+			// * apply tool choice of this turn
+			callRequest.ToolChoice = r.Option.ToolChoice
+			if state.OnToolChoice != nil {
+				if toolChoice := state.OnToolChoice(budget.Turns); toolChoice != nil {
+					callRequest.ToolChoice = toolChoice
 				}
-				toolCall.Error = gut.Ptr("declaration not found for tool: " + gut.Val(toolCall.Name))
-				toolCalls = append(toolCalls, toolCall)
-				continue
 			}
-
-			// * unmarshal arguments from json
-			elem := reflect.TypeOf(declaration.Arguments).Elem()
-			for elem.Kind() == reflect.Ptr {
-				elem = elem.Elem()
+			if loopToolChoice != nil {
+				callRequest.ToolChoice = loopToolChoice
+				loopToolChoice = nil
 			}
-			arguments := reflect.New(elem).Interface()
-			if len(toolCall.Arguments) > 0 && elem.Kind() != reflect.Interface {
-				if err := json.Unmarshal(toolCall.Arguments, arguments); err != nil {
-					if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
-						return nil, gut.Err(false, fmt.Sprintf("failed to unmarshal arguments for tool %s: %s", gut.Val(toolCall.Name), err.Error()), err)
-					}
-					toolCall.Error = gut.Ptr("failed to unmarshal arguments: " + err.Error())
-					toolCalls = append(toolCalls, toolCall)
-					continue
+
+			// * compact older tool messages when request nears the context window
+			callRequest.Messages = state.Messages()
+			if r.Option.Compaction != nil {
+				if err := r.Compact(state, callRequest); err != nil {
+					gut.Debug("function calling compaction failed", err)
+				} else {
+					callRequest.Messages = state.Messages()
 				}
 			}
 
-			// * invoke callback before execution with response as nil
-			callback := &CallbackBeforeFunctionCall{
-				ToolCallId:  toolCall.Id,
-				Declaration: declaration,
-				Arguments:   arguments,
+			// * call underlying caller with corrective nudge of a detected loop
+			if answer != nil {
+				callRequest.Messages = append(callRequest.Messages, answer)
+				answer = nil
 			}
-			if state.OnBeforeFunctionCall != nil {
-				alter, err := state.OnBeforeFunctionCall(callback)
-				if alter != nil {
-					arguments = alter
-				}
+			if nudge != nil {
+				callRequest.Messages = append(callRequest.Messages, nudge)
+				nudge = nil
+			}
+
+			// * invoke request hook able to change the request of this turn
+			turn := budget.Turns
+			if state.OnRequest != nil {
+				state.mutex.Lock()
+				err := state.OnRequest(state, turn, callRequest)
+				state.mutex.Unlock()
 				if err != nil {
 					return nil, err
 				}
 			}
 
-			// * execute function to get response
-			functionResponse, funcErr := declaration.Func(arguments)
-			if funcErr != nil {
-				if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
-					return nil, gut.Err(false, "function execution error for tool "+gut.Val(toolCall.Name)+": "+funcErr.Error(), funcErr)
+			var err *gut.ErrorInstance
+			response, err = r.CallModel(state, callRequest, structured)
+			if err != nil {
+				return nil, err
+			}
+			budget.Consume(response.Message.Usage)
+
+			// * invoke response hook before the finish reason is handled
+			if state.OnResponse != nil {
+				state.mutex.Lock()
+				err := state.OnResponse(state, turn, response)
+				state.mutex.Unlock()
+				if err != nil {
+					return nil, err
 				}
-				toolCall.Error = gut.Ptr("function execution error: " + funcErr.Error())
-				toolCalls = append(toolCalls, toolCall)
-
-				if state.OnAfterFunctionCall != nil {
-					alter, err := state.OnAfterFunctionCall(&CallbackAfterFunctionCall{
-						CallbackBeforeFunctionCall: *callback,
-						Result:                     nil,
-						Error:                      toolCall.Error,
-					})
-					if alter != nil {
-						functionResponse = alter
+			}
+
+			// * check if there are tool calls
+			if response.FinishReason != "tool_calls" && len(response.Message.ToolCalls) == 0 {
+				// * require terminator when the model answers without calling it
+				if terminator := r.Terminator(); terminator != nil {
+					if reprompted {
+						return nil, gut.Err(false, "terminator "+gut.Val(terminator.Name)+" was not called")
 					}
-					if err != nil {
-						return nil, err
+					reprompted = true
+					answer = response.Message
+					nudge = &call.UserMessage{
+						Content: gut.Ptr("Give your final answer by calling the " + gut.Val(terminator.Name) + " tool."),
 					}
+					loopToolChoice = &call.ToolChoice{
+						Mode: gut.Ptr(call.ToolChoiceModeTool),
+						Name: terminator.Name,
+					}
+					continue
 				}
 
-				continue
+				// * append final message
+				callRequest.Messages = append(callRequest.Messages, response.Message)
+
+				// * aggregate usage from all messages
+				response.TotalUsage = r.StateUsage(state, callRequest.Messages)
+
+				return response, nil
 			}
 
-			// * invoke callback after execution with response
-			if state.OnAfterFunctionCall != nil {
-				alter, err := state.OnAfterFunctionCall(&CallbackAfterFunctionCall{
-					CallbackBeforeFunctionCall: *callback,
-					Result:                     functionResponse,
-					Error:                      nil,
-				})
-				if alter != nil {
-					functionResponse = alter
-				}
-				if err != nil {
-					return nil, err
-				}
+			// * check tool call budget before execution
+			if budget.ExceededToolCalls(r.Option, len(response.Message.ToolCalls)) {
+				return r.BudgetEnd(state, callRequest, output, BudgetLimitToolCalls)
 			}
+			budget.ToolCalls += len(response.Message.ToolCalls)
 
-			// * marshal response to json
-			responseJson, err := json.Marshal(functionResponse)
-			if err != nil {
-				if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
-					return nil, gut.Err(false, fmt.Sprintf("failed to marshal response for tool %s: %s", gut.Val(toolCall.Name), err.Error()), err)
-				}
-				toolCall.Error = gut.Ptr("failed to marshal response: " + err.Error())
-				toolCalls = append(toolCalls, toolCall)
-				continue
+			// * checkpoint model turn so an interrupted run resumes its tool calls
+			state.Pending = response.Message
+			if err := r.Checkpoint(state); err != nil {
+				return nil, err
 			}
+		}
+
+		// * execute tool calls of this turn
+		if err := r.ExecuteAll(state, response.Message.ToolCalls); err != nil {
+			return nil, err
+		}
 
-			// * create tool result message
-			toolCall.Result = responseJson
-			toolCalls = append(toolCalls, toolCall)
+		// * suspend when tool calls are waiting for approval
+		if len(state.PendingToolCalls()) > 0 {
+			if err := r.Checkpoint(state); err != nil {
+				return nil, err
+			}
+			response.FinishReason = FinishReasonSuspended
+			response.TotalUsage = r.StateUsage(state, append(state.Messages(), response.Message))
+			return response, nil
 		}
+		state.Pending = nil
+		state.Approvals = nil
 
 		toolMessage := &call.AssistantMessage{
 			Content:   response.Message.Content,
-			ToolCalls: toolCalls,
+			ToolCalls: response.Message.ToolCalls,
 			Usage:     response.Message.Usage,
 		}
 
@@ -209,7 +329,7 @@ func (r *Call) Call(state *State, output any) (*call.Response, *gut.ErrorInstanc
 			for i := len(state.ToolMessages) - 1; i >= 0; i-- {
 				tm := state.ToolMessages[i]
 				if len(tm.ToolCalls) == 1 && tm.ToolCalls[0].Error != nil {
-					if toolMessage.ToolCalls[0].Name == tm.ToolCalls[0].Name {
+					if gut.Val(toolMessage.ToolCalls[0].Name) == gut.Val(tm.ToolCalls[0].Name) {
 						// * remove previous error message
 						state.ToolMessages = append(state.ToolMessages[:i], state.ToolMessages[i+1:]...)
 					}
@@ -220,20 +340,497 @@ func (r *Call) Call(state *State, output any) (*call.Response, *gut.ErrorInstanc
 
 		// * call callback
 		if state.OnToolMessage != nil {
-			if err := state.OnToolMessage(toolMessage); err != nil {
+			state.mutex.Lock()
+			err := state.OnToolMessage(toolMessage)
+			state.mutex.Unlock()
+			if err != nil {
 				return nil, err
 			}
 		}
 
 		// * append tool message to state
 		state.ToolMessages = append(state.ToolMessages, toolMessage)
+
+		// * checkpoint completed tool batch
+		if err := r.Checkpoint(state); err != nil {
+			return nil, err
+		}
+
+		// * end loop with terminator arguments as the final result
+		if toolCall := r.Terminated(response.Message.ToolCalls); toolCall != nil {
+			if output != nil {
+				if err := json.Unmarshal(toolCall.Arguments, output); err != nil {
+					return nil, gut.Err(false, "failed to unmarshal terminator arguments to output", err)
+				}
+			}
+			response.TotalUsage = r.StateUsage(state, state.Messages())
+			return response, nil
+		}
+
+		// * respond to unproductive loops
+		if loopError := loop.Observe(r.Option.LoopDetection, response.Message.ToolCalls); loopError != nil {
+			gut.Debug("function calling loop detected", loopError)
+			switch gut.Val(r.Option.LoopDetection.Action, LoopActionNudge) {
+			case LoopActionAbort:
+				return nil, gut.Err(false, loopError.Error(), LoopErrorCode, loopError)
+			case LoopActionToolChoice:
+				loopToolChoice = r.Option.LoopDetection.ToolChoice
+				if loopToolChoice == nil {
+					loopToolChoice = &call.ToolChoice{Mode: gut.Ptr(call.ToolChoiceModeNone)}
+				}
+			default:
+				nudge = LoopNudge(r.Option.LoopDetection, loopError)
+			}
+		}
+	}
+}
+
+// Terminator returns the first terminator declaration, or nil if none is declared
+func (r *Call) Terminator() *Declaration {
+	for _, declaration := range r.Declarations {
+		if declaration.Terminator != nil && *declaration.Terminator {
+			return declaration
+		}
+	}
+	return nil
+}
+
+// Terminated returns the first successful tool call of a terminator declaration, or nil if the loop should continue
+func (r *Call) Terminated(toolCalls []*call.ToolCall) *call.ToolCall {
+	for _, toolCall := range toolCalls {
+		if toolCall.Error != nil {
+			continue
+		}
+		declaration := r.GetDeclaration(toolCall.Name)
+		if declaration != nil && declaration.Terminator != nil && *declaration.Terminator {
+			return toolCall
+		}
+	}
+	return nil
+}
+
+// ExecuteAll runs tool calls of a model turn with the configured concurrency, results stay in their original order,
+// each tool call is checkpointed on completion and a serial declaration runs alone after all preceding tool calls succeed
+func (r *Call) ExecuteAll(state *State, toolCalls []*call.ToolCall) *gut.ErrorInstance {
+	concurrency := 1
+	if r.Option.ToolConcurrency != nil && *r.Option.ToolConcurrency > 1 {
+		concurrency = *r.Option.ToolConcurrency
+	}
+
+	errs := make([]*gut.ErrorInstance, len(toolCalls))
+	semaphore := make(chan struct{}, concurrency)
+	var wait sync.WaitGroup
+	failed := func() *gut.ErrorInstance {
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, toolCall := range toolCalls {
+		// * run serially when concurrency is disabled or declaration is serial, after concurrent calls succeeded
+		declaration := r.GetDeclaration(toolCall.Name)
+		if concurrency == 1 || (declaration != nil && declaration.Serial != nil && *declaration.Serial) {
+			wait.Wait()
+			if err := failed(); err != nil {
+				return err
+			}
+			if err := r.Execute(state, toolCall); err != nil {
+				return err
+			}
+			if err := r.Checkpoint(state); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// * run concurrently within concurrency limit
+		wait.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wait.Done()
+			defer func() { <-semaphore }()
+
+			// * execute on a copy so checkpoints never read a tool call while it runs
+			executed := *toolCall
+			if errs[i] = r.Execute(state, &executed); errs[i] != nil {
+				return
+			}
+
+			// * publish and checkpoint each finished call so a crash never repeats it
+			state.mutex.Lock()
+			defer state.mutex.Unlock()
+			*toolCall = executed
+			errs[i] = r.Checkpoint(state)
+		}()
+	}
+	wait.Wait()
+
+	return failed()
+}
+
+// Execute runs a single tool call against its declaration and sets the tool call result or error,
+// a returned error breaks the function calling loop
+func (r *Call) Execute(state *State, toolCall *call.ToolCall) *gut.ErrorInstance {
+	// * skip tool calls already executed before suspension
+	if toolCall.Result != nil || toolCall.Error != nil {
+		return nil
+	}
+
+	// * find matching declaration
+	declaration := r.GetDeclaration(toolCall.Name)
+	if declaration == nil {
+		if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
+			return gut.Err(false, "declaration not found for tool: "+gut.Val(toolCall.Name), nil)
+		}
+		toolCall.Error = (&ToolError{
+			Kind:      ToolErrorKindUnknownTool,
+			Tool:      toolCall.Name,
+			Message:   "declaration not found for tool: " + gut.Val(toolCall.Name),
+			Retryable: true,
+			Hints:     []string{"call one of the available tools instead"},
+			Tools:     ToolClosest(r.Available(), gut.Val(toolCall.Name), 3),
+		}).Render()
+		return nil
+	}
+
+	// * apply approval decision, leaving the tool call pending until decided
+	if declaration.Approval != nil && *declaration.Approval {
+		approval := state.Approvals[gut.Val(toolCall.Id)]
+		if approval == nil {
+			return nil
+		}
+		switch approval.Decision {
+		case ApprovalDecisionApproved:
+			if approval.Arguments != nil {
+				toolCall.Arguments = approval.Arguments
+			}
+		case ApprovalDecisionRejected:
+			toolCall.Error = (&ToolError{
+				Kind:      ToolErrorKindRejected,
+				Tool:      toolCall.Name,
+				Message:   "function call rejected: " + gut.Val(approval.Reason, "no reason given"),
+				Retryable: false,
+				Hints:     []string{"do not repeat this call, choose another approach or ask the user"},
+			}).Render()
+			return nil
+		default:
+			return gut.Err(false, "unknown approval decision for tool "+gut.Val(toolCall.Name)+": "+string(approval.Decision), nil)
+		}
+	}
+
+	// * unmarshal arguments from json
+	elem := reflect.TypeOf(declaration.Arguments).Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	arguments := reflect.New(elem).Interface()
+	var repairs []string
+	if len(toolCall.Arguments) > 0 && elem.Kind() != reflect.Interface {
+		// * repair and coerce arguments unless declaration is strict
+		var argumentsJson []byte
+		argumentsJson, repairs = r.ArgumentsRepair(declaration, toolCall.Arguments)
+		if err := json.Unmarshal(argumentsJson, arguments); err != nil {
+			if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
+				return gut.Err(false, fmt.Sprintf("failed to unmarshal arguments for tool %s: %s", gut.Val(toolCall.Name), err.Error()), err)
+			}
+			toolCall.Error = (&ToolError{
+				Kind:      ToolErrorKindInvalidArguments,
+				Tool:      toolCall.Name,
+				Message:   "failed to unmarshal arguments: " + err.Error(),
+				Retryable: true,
+				Hints:     []string{"send arguments as a json object matching the schema"},
+				Schema:    declaration.ArgumentsSchema,
+			}).Render()
+			return nil
+		}
+	}
+
+	// * validate arguments
+	if fieldErrors := call.OutputValidate(arguments); len(fieldErrors) > 0 {
+		if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
+			return gut.Err(false, fmt.Sprintf("invalid arguments for tool %s: %s", gut.Val(toolCall.Name), strings.Join(fieldErrors, "; ")), nil)
+		}
+		toolCall.Error = (&ToolError{
+			Kind:      ToolErrorKindInvalidArguments,
+			Tool:      toolCall.Name,
+			Message:   "invalid arguments: " + strings.Join(fieldErrors, "; "),
+			Retryable: true,
+			Hints:     fieldErrors,
+			Schema:    declaration.ArgumentsSchema,
+		}).Render()
+		return nil
+	}
+
+	// * invoke callback before execution with response as nil
+	callback := &CallbackBeforeFunctionCall{
+		ToolCallId:  toolCall.Id,
+		Declaration: declaration,
+		Arguments:   arguments,
+		Repairs:     repairs,
+	}
+	if state.OnBeforeFunctionCall != nil {
+		state.mutex.Lock()
+		alter, err := state.OnBeforeFunctionCall(callback)
+		state.mutex.Unlock()
+		if alter != nil {
+			arguments = alter
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// * execute function to get response, answering cacheable calls from cache
+	cacheKey := r.CacheKey(declaration, arguments)
+	cacheEntry := r.CacheGet(state, cacheKey)
+	var functionResponse any
+	var funcErr *gut.ErrorInstance
+	var timedOut bool
+	if cacheEntry != nil {
+		callback.Cached = gut.Ptr(true)
+		functionResponse = NewResult(json.RawMessage(cacheEntry.Result), cacheEntry.Parts...)
+	} else {
+		var callbackErr *gut.ErrorInstance
+		functionResponse, funcErr, timedOut, callbackErr = r.InvokeRetry(state, declaration, toolCall, arguments, callback)
+		if callbackErr != nil {
+			return callbackErr
+		}
+	}
+	if state.Context != nil && state.Context.Err() != nil {
+		return gut.Err(false, "function call cancelled for tool "+gut.Val(toolCall.Name), state.Context.Err())
+	}
+	if funcErr != nil || timedOut {
+		if timedOut {
+			// * report timeout to the model as structured error
+			toolCall.Error = (&ToolError{
+				Kind:      ToolErrorKindTimeout,
+				Tool:      toolCall.Name,
+				Message:   "function call did not complete within " + r.Timeout(declaration).String(),
+				Retryable: true,
+				Hints:     []string{"retry with a smaller input or narrower arguments"},
+			}).Render()
+		} else if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
+			return gut.Err(false, "function execution error for tool "+gut.Val(toolCall.Name)+": "+funcErr.Error(), funcErr)
+		} else {
+			toolCall.Error = r.ExecutionError(toolCall, funcErr)
+		}
+
+		if state.OnAfterFunctionCall != nil {
+			state.mutex.Lock()
+			alter, err := state.OnAfterFunctionCall(&CallbackAfterFunctionCall{
+				CallbackBeforeFunctionCall: *callback,
+				Result:                     nil,
+				Error:                      toolCall.Error,
+			})
+			state.mutex.Unlock()
+			if alter != nil {
+				functionResponse = alter
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// * invoke callback after execution with response
+	if state.OnAfterFunctionCall != nil {
+		state.mutex.Lock()
+		alter, err := state.OnAfterFunctionCall(&CallbackAfterFunctionCall{
+			CallbackBeforeFunctionCall: *callback,
+			Result:                     CallbackResult(functionResponse),
+			Value:                      functionResponse,
+			Error:                      nil,
+		})
+		state.mutex.Unlock()
+		if alter != nil {
+			functionResponse = CallbackAlter(functionResponse, alter)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// * separate content parts from result value
+	if result, ok := functionResponse.(*Result); ok && result != nil {
+		toolCall.Parts = result.Parts
+		functionResponse = result.Value
 	}
+
+	// * marshal response to json
+	responseJson, err := json.Marshal(functionResponse)
+	if err != nil {
+		if r.Option.ParseErrorBreak != nil && *r.Option.ParseErrorBreak {
+			return gut.Err(false, fmt.Sprintf("failed to marshal response for tool %s: %s", gut.Val(toolCall.Name), err.Error()), err)
+		}
+		toolCall.Error = (&ToolError{
+			Kind:      ToolErrorKindExecutionFailed,
+			Tool:      toolCall.Name,
+			Message:   "failed to marshal response: " + err.Error(),
+			Retryable: false,
+		}).Render()
+		return nil
+	}
+
+	// * memoise result of cacheable declaration
+	if cacheEntry == nil {
+		r.CachePut(state, declaration, cacheKey, responseJson, toolCall.Parts)
+	}
+
+	// * create tool result message bounded by result limit
+	toolCall.Result = r.Limit(state, declaration, toolCall, responseJson)
+
+	return nil
+}
+
+// ExecutionError renders the error returned by a tool function as envelope,
+// a tool error returned by the function is kept with its kind and hints
+func (r *Call) ExecutionError(toolCall *call.ToolCall, funcErr *gut.ErrorInstance) *string {
+	toolError := &ToolError{
+		Kind:      ToolErrorKindExecutionFailed,
+		Message:   "function execution error: " + funcErr.Error(),
+		Retryable: false,
+	}
+	if carried := ToolErrorOf(funcErr); carried != nil {
+		copied := *carried
+		toolError = &copied
+	}
+	if toolError.Kind == "" {
+		toolError.Kind = ToolErrorKindExecutionFailed
+	}
+	toolError.Tool = toolCall.Name
+	return toolError.Render()
+}
+
+// BudgetEnd ends the function calling loop after reaching limit with a BudgetError,
+// when summary is enabled, one final call without tools asks the model to summarise the progress
+func (r *Call) BudgetEnd(state *State, callRequest *call.Request, output any, limit BudgetLimit) (*call.Response, *gut.ErrorInstance) {
+	budgetError := &BudgetError{
+		Limit:    limit,
+		Response: nil,
+	}
+
+	if r.Option.BudgetSummary != nil && *r.Option.BudgetSummary {
+		// * construct summary request without tools
+		summaryRequest := *callRequest
+		summaryRequest.Tools = nil
+		summaryRequest.ToolChoice = nil
+		summaryRequest.Messages = append(state.Messages(), &call.UserMessage{
+			Content: gut.Ptr("The " + string(limit) + " budget of this task is exhausted and no more tools can be used. Summarise what you have done and found so far as your final answer."),
+		})
+
+		response, err := r.Caller.Call(&summaryRequest, r.Option.CallOption, output)
+		if err != nil {
+			return nil, gut.Err(false, "budget summary call failed", err)
+		}
+		state.Budget.Spend(response.Message.Usage)
+		response.TotalUsage = r.StateUsage(state, append(summaryRequest.Messages, response.Message))
+		budgetError.Response = response
+	}
+
+	return nil, gut.Err(false, budgetError.Error(), BudgetErrorCode, budgetError)
+}
+
+// CallModel calls the underlying caller for a model turn and stops waiting when the state context is done,
+// a cancelled call keeps running in background and its structured output is discarded
+func (r *Call) CallModel(state *State, request *call.Request, output any) (*call.Response, *gut.ErrorInstance) {
+	if state.Context == nil {
+		return r.Caller.Call(request, r.Option.CallOption, output)
+	}
+
+	// * decode structured output into a separate instance so a cancelled call never writes output
+	target := output
+	if value := reflect.ValueOf(output); value.Kind() == reflect.Ptr && !value.IsNil() {
+		target = reflect.New(value.Type().Elem()).Interface()
+	}
+
+	type result struct {
+		response *call.Response
+		err      *gut.ErrorInstance
+	}
+	done := make(chan *result, 1)
+	go func() {
+		response, err := r.Caller.Call(request, r.Option.CallOption, target)
+		done <- &result{response: response, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err == nil && target != output {
+			reflect.ValueOf(output).Elem().Set(reflect.ValueOf(target).Elem())
+		}
+		return result.response, result.err
+	case <-state.Context.Done():
+		return nil, gut.Err(false, "model call cancelled: "+state.Context.Err().Error(), state.Context.Err())
+	}
+}
+
+// TotalUsage aggregates usage from all assistant messages
+func (r *Call) TotalUsage(messages []call.Message) *call.Usage {
+	usage := UsageAdd(nil, nil)
+	for _, message := range messages {
+		if m, ok := message.(*call.AssistantMessage); ok {
+			usage = UsageAdd(usage, m.Usage)
+		}
+	}
+	return usage
+}
+
+// StateUsage aggregates usage from messages and the compacted messages summarised in state
+func (r *Call) StateUsage(state *State, messages []call.Message) *call.Usage {
+	usage := r.TotalUsage(messages)
+	if state.Summary != nil {
+		usage = UsageAdd(usage, state.Summary.Usage)
+	}
+	return usage
+}
+
+// Available returns registered declarations followed by built-in declarations enabled by option
+func (r *Call) Available() []*Declaration {
+	declarations := r.Declarations
+	if length := r.ArtifactLength(); length > 0 && r.GetRegistered(gut.Ptr("read_artifact")) == nil {
+		declarations = append(slices.Clip(declarations), r.Builtin("read_artifact/"+strconv.Itoa(length), func() *Declaration {
+			return NewArtifactReader(r.Option.ArtifactStore, length)
+		}))
+	}
+	if r.Option.ToolSearch != nil && *r.Option.ToolSearch && r.GetRegistered(gut.Ptr("search_tools")) == nil {
+		declarations = append(slices.Clip(declarations), r.Builtin("search_tools", func() *Declaration {
+			return NewToolSearch(func() []*Declaration {
+				return r.Declarations
+			})
+		}))
+	}
+	return declarations
+}
+
+// Builtin returns the built-in declaration cached under key, building it on first use
+func (r *Call) Builtin(key string, build func() *Declaration) *Declaration {
+	r.builtinMutex.Lock()
+	defer r.builtinMutex.Unlock()
+	if r.builtins == nil {
+		r.builtins = make(map[string]*Declaration)
+	}
+	declaration, ok := r.builtins[key]
+	if !ok {
+		declaration = build()
+		r.builtins[key] = declaration
+	}
+	return declaration
 }
 
 // Tools converts function declarations to call.Tool format
 func (r *Call) Tools() []*call.Tool {
+	return DeclarationTools(r.Available())
+}
+
+// DeclarationTools converts declarations to call.Tool format
+func DeclarationTools(declarations []*Declaration) []*call.Tool {
 	var tools []*call.Tool
-	for _, declaration := range r.Declarations {
+	for _, declaration := range declarations {
 		tool := &call.Tool{
 			Type:        gut.Ptr("function"),
 			Name:        declaration.Name,
@@ -245,12 +842,22 @@ func (r *Call) Tools() []*call.Tool {
 	return tools
 }
 
-// GetDeclaration finds a function declaration by name
+// GetDeclaration finds a function declaration by name, including built-in declarations
 func (r *Call) GetDeclaration(name *string) *Declaration {
+	return DeclarationFind(r.Available(), name)
+}
+
+// GetRegistered finds a registered function declaration by name
+func (r *Call) GetRegistered(name *string) *Declaration {
+	return DeclarationFind(r.Declarations, name)
+}
+
+// DeclarationFind finds a function declaration by name in declarations
+func DeclarationFind(declarations []*Declaration, name *string) *Declaration {
 	if name == nil {
 		return nil
 	}
-	for _, declaration := range r.Declarations {
+	for _, declaration := range declarations {
 		if declaration.Name != nil && *declaration.Name == *name {
 			return declaration
 		}
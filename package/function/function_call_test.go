@@ -1,9 +1,17 @@
 package function
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bsthun/gut"
 	"github.com/stretchr/testify/assert"
@@ -132,3 +140,1391 @@ func TestCallMagicNumber(t *testing.T) {
 		assert.NotNil(t, checkNumberInvoke, "check_number should be called")
 	})
 }
+
+func TestCallParallel(t *testing.T) {
+	type SleepArguments struct {
+		Index int `json:"index"`
+	}
+
+	newCall := func(concurrency int, serial bool) (*Call, *int32) {
+		turn := 0
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				turn++
+				if turn > 1 {
+					return CallerStubTextResponse("done")
+				}
+				response := CallerStubToolResponse("0", "sleep", `{"index": 0}`)
+				for i := 1; i < 4; i++ {
+					response.Message.ToolCalls = append(response.Message.ToolCalls, &call.ToolCall{
+						Id:        gut.Ptr(fmt.Sprint(i)),
+						Name:      gut.Ptr("sleep"),
+						Arguments: []byte(fmt.Sprintf(`{"index": %d}`, i)),
+					})
+				}
+				return response
+			},
+		}
+
+		running := new(int32)
+		peak := new(int32)
+		functionCall := New(caller, &Option{ToolConcurrency: gut.Ptr(concurrency)}).(*Call)
+		declaration := NewDeclaration(
+			gut.Ptr("sleep"),
+			gut.Ptr("Sleep"),
+			func(arguments *SleepArguments) (map[string]any, *gut.ErrorInstance) {
+				current := atomic.AddInt32(running, 1)
+				for {
+					previous := atomic.LoadInt32(peak)
+					if current <= previous || atomic.CompareAndSwapInt32(peak, previous, current) {
+						break
+					}
+				}
+				time.Sleep(time.Duration(40-arguments.Index*10) * time.Millisecond)
+				atomic.AddInt32(running, -1)
+				return map[string]any{"index": arguments.Index}, nil
+			},
+		)
+		declaration.Serial = gut.Ptr(serial)
+		functionCall.AddDeclaration(declaration)
+		return functionCall, peak
+	}
+
+	t.Run("ConcurrentOrdered", func(t *testing.T) {
+		functionCall, peak := newCall(2, false)
+		state := NewState(nil)
+		callbacks := 0
+		state.OnAfterFunctionCall = func(callback *CallbackAfterFunctionCall) (map[string]any, *gut.ErrorInstance) {
+			callbacks++
+			return nil, nil
+		}
+
+		_, err := functionCall.Call(state, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), *peak)
+		assert.Equal(t, 4, callbacks)
+		for i, toolCall := range state.ToolMessages[0].ToolCalls {
+			assert.Equal(t, fmt.Sprintf(`{"index":%d}`, i), string(toolCall.Result))
+		}
+	})
+
+	t.Run("SerialDeclaration", func(t *testing.T) {
+		functionCall, peak := newCall(4, true)
+
+		_, err := functionCall.Call(NewState(nil), nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(1), *peak)
+	})
+}
+
+func TestCallTerminator(t *testing.T) {
+	type Answer struct {
+		Result *string `json:"result" validate:"required"`
+	}
+
+	responses := []*call.Response{
+		CallerStubToolResponse("1", "submit_answer", `{}`),
+		CallerStubToolResponse("2", "submit_answer", `{"result": "42"}`),
+		CallerStubTextResponse("unreachable"),
+	}
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			return responses[len(request.Messages)-1]
+		},
+	}
+	functionCall := New(caller, &Option{})
+	functionCall.AddDeclaration(NewTerminator[Answer](gut.Ptr("submit_answer"), gut.Ptr("Submit the final answer")))
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("What is the answer?")},
+	})
+	output := new(Answer)
+
+	response, err := functionCall.Call(state, output)
+
+	assert.Nil(t, err)
+	assert.NotNil(t, response)
+	assert.Equal(t, "42", *output.Result)
+	assert.Len(t, caller.Requests, 2)
+	assert.Nil(t, caller.Outputs[0])
+	assert.NotNil(t, state.ToolMessages[0].ToolCalls[0].Error)
+}
+
+func TestCallTerminatorNotCalled(t *testing.T) {
+	type Answer struct {
+		Result *string `json:"result" validate:"required"`
+	}
+
+	t.Run("Reprompt", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				if request.ToolChoice == nil {
+					return CallerStubTextResponse("42")
+				}
+				return CallerStubToolResponse("1", "submit_answer", `{"result": "42"}`)
+			},
+		}
+		functionCall := New(caller, &Option{})
+		functionCall.AddDeclaration(NewTerminator[Answer](gut.Ptr("submit_answer"), gut.Ptr("Submit the final answer")))
+		output := new(Answer)
+
+		_, err := functionCall.Call(NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("What is the answer?")},
+		}), output)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "42", *output.Result)
+		assert.Len(t, caller.Requests, 2)
+		assert.Equal(t, call.ToolChoiceModeTool, *caller.Requests[1].ToolChoice.Mode)
+		assert.Equal(t, "submit_answer", *caller.Requests[1].ToolChoice.Name)
+		assert.Len(t, caller.Requests[1].Messages, 3)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				return CallerStubTextResponse("42")
+			},
+		}
+		functionCall := New(caller, &Option{})
+		functionCall.AddDeclaration(NewTerminator[Answer](gut.Ptr("submit_answer"), gut.Ptr("Submit the final answer")))
+		output := new(Answer)
+
+		response, err := functionCall.Call(NewState(nil), output)
+
+		assert.Nil(t, response)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "submit_answer was not called")
+		assert.Len(t, caller.Requests, 2)
+		assert.Nil(t, output.Result)
+	})
+}
+
+func TestCallToolChoice(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return CallerStubToolResponse("1", "ping", "{}")
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	functionCall := New(caller, &Option{
+		ToolChoice: &call.ToolChoice{Mode: gut.Ptr(call.ToolChoiceModeAuto)},
+	})
+	functionCall.AddDeclaration(NewDeclaration(
+		gut.Ptr("ping"),
+		gut.Ptr("Ping"),
+		func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+			return map[string]any{"pong": true}, nil
+		},
+	))
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Ping once")},
+	})
+	state.OnToolChoice = func(turn int) *call.ToolChoice {
+		if turn == 0 {
+			return &call.ToolChoice{Mode: gut.Ptr(call.ToolChoiceModeTool), Name: gut.Ptr("ping")}
+		}
+		return nil
+	}
+
+	_, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Len(t, caller.Requests, 2)
+	assert.Equal(t, call.ToolChoiceModeTool, *caller.Requests[0].ToolChoice.Mode)
+	assert.Equal(t, call.ToolChoiceModeAuto, *caller.Requests[1].ToolChoice.Mode)
+}
+
+// CallerStub is a call.Caller returning scripted responses for tests without inference service
+type CallerStub struct {
+	Requests []*call.Request
+	Outputs  []any
+	Respond  func(request *call.Request) *call.Response
+}
+
+func (r *CallerStub) Call(request *call.Request, option *call.Option, output any) (*call.Response, *gut.ErrorInstance) {
+	copied := *request
+	copied.Messages = append([]call.Message(nil), request.Messages...)
+	r.Requests = append(r.Requests, &copied)
+	r.Outputs = append(r.Outputs, output)
+	return r.Respond(&copied), nil
+}
+
+func TestCallApproval(t *testing.T) {
+	type Refund struct {
+		Amount *int `json:"amount"`
+	}
+
+	suspended := CallerStubToolResponse("1", "refund", `{"amount": 100}`)
+	suspended.Message.ToolCalls = append(suspended.Message.ToolCalls,
+		CallerStubToolResponse("2", "refund", `{"amount": 900}`).Message.ToolCalls[0],
+		CallerStubToolResponse("3", "ping", `{}`).Message.ToolCalls[0],
+	)
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return suspended
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	refunds := make([]int, 0)
+	newCall := func() Caller {
+		functionCall := New(caller, &Option{})
+		declaration := NewDeclaration(
+			gut.Ptr("refund"),
+			gut.Ptr("Refund an order"),
+			func(arguments *Refund) (map[string]any, *gut.ErrorInstance) {
+				refunds = append(refunds, *arguments.Amount)
+				return map[string]any{"refunded": *arguments.Amount}, nil
+			},
+		)
+		declaration.Approval = gut.Ptr(true)
+		functionCall.AddDeclaration(declaration)
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr("ping"),
+			gut.Ptr("Ping"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				return map[string]any{"pong": true}, nil
+			},
+		))
+		return functionCall
+	}
+	initialMessages := []call.Message{
+		&call.UserMessage{Content: gut.Ptr("Refund both orders")},
+	}
+	state := NewState(initialMessages)
+
+	// * first run suspends with approval tool calls pending
+	response, err := newCall().Call(state, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, FinishReasonSuspended, response.FinishReason)
+	assert.True(t, state.Suspended())
+	assert.Len(t, state.PendingToolCalls(), 2)
+	assert.Empty(t, refunds)
+	assert.Empty(t, state.ToolMessages)
+
+	// * persist state and restore it in another process
+	content, marshalErr := json.Marshal(state)
+	assert.Nil(t, marshalErr)
+	restored := new(State)
+	assert.Nil(t, json.Unmarshal(content, restored))
+	assert.Equal(t, state.InitialMessages, restored.InitialMessages)
+	assert.Nil(t, restored.Approve("1", []byte(`{"amount": 50}`)))
+	assert.Nil(t, restored.Reject("2", gut.Ptr("amount too large")))
+	assert.NotNil(t, restored.Approve("3", nil))
+
+	// * resume executes approved tool calls without calling model for the suspended turn
+	response, err = newCall().Call(restored, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+	assert.Equal(t, []int{50}, refunds)
+	assert.False(t, restored.Suspended())
+	assert.Len(t, caller.Requests, 2)
+	toolCalls := restored.ToolMessages[0].ToolCalls
+	assert.NotNil(t, toolCalls[0].Result)
+	assert.Contains(t, *toolCalls[1].Error, "amount too large")
+	assert.NotNil(t, toolCalls[2].Result)
+}
+
+func TestCallApprovalUnknown(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return CallerStubToolResponse("1", "refund", `{}`)
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	refunded := false
+	functionCall := New(caller, &Option{})
+	declaration := NewDeclaration(
+		gut.Ptr("refund"),
+		gut.Ptr("Refund an order"),
+		func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+			refunded = true
+			return map[string]any{"refunded": true}, nil
+		},
+	)
+	declaration.Approval = gut.Ptr(true)
+	functionCall.AddDeclaration(declaration)
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Refund the order")},
+	})
+
+	// * suspend and reject decisions other than approved or rejected
+	_, err := functionCall.Call(state, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, state.ApprovalSet("1", &Approval{Decision: "approve"}))
+	assert.Nil(t, state.Approvals["1"])
+
+	// * unknown decision restored from a checkpoint never runs the tool
+	state.Approvals = map[string]*Approval{"1": {Decision: "yes"}}
+	_, err = functionCall.Call(state, nil)
+	assert.NotNil(t, err)
+	assert.False(t, refunded)
+}
+
+func TestCallTimeout(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return CallerStubToolResponse("1", "slow", "{}")
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	functionCall := New(caller, &Option{
+		ToolTimeout: gut.Ptr(time.Hour),
+	})
+	declaration := NewDeclarationContext(
+		gut.Ptr("slow"),
+		gut.Ptr("Slow operation"),
+		func(ctx *DeclarationContext, arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+			assert.Equal(t, "1", *ctx.ToolCall.Id)
+			<-ctx.Done()
+			return nil, gut.Err(false, "interrupted")
+		},
+	)
+	declaration.Timeout = gut.Ptr(20 * time.Millisecond)
+	functionCall.AddDeclaration(declaration)
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Run slow operation")},
+	})
+
+	response, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+	timeout := ToolErrorParse(state.ToolMessages[0].ToolCalls[0].Error)
+	assert.Equal(t, ToolErrorKindTimeout, timeout.Kind)
+	assert.Equal(t, "slow", *timeout.Tool)
+	assert.True(t, timeout.Retryable)
+	assert.Contains(t, timeout.Message, "20ms")
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		state := NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Run slow operation")},
+		})
+		state.Context = ctx
+		time.AfterFunc(20*time.Millisecond, cancel)
+		declaration.Timeout = nil
+
+		response, err := functionCall.Call(state, nil)
+
+		assert.Nil(t, response)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCallResult(t *testing.T) {
+	type Screenshot struct {
+		Width  *int `json:"width"`
+		Height *int `json:"height"`
+	}
+
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return CallerStubToolResponse("1", "screenshot", "{}")
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	functionCall := New(caller, &Option{})
+	functionCall.AddDeclaration(NewDeclarationResult(
+		gut.Ptr("screenshot"),
+		gut.Ptr("Capture the screen"),
+		func(ctx *DeclarationContext, arguments *struct{}) (*Result, *gut.ErrorInstance) {
+			return NewResult(&Screenshot{
+				Width:  gut.Ptr(640),
+				Height: gut.Ptr(480),
+			}, call.NewImagePart([]byte{0x89}, "image/png")), nil
+		},
+	))
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Take a screenshot")},
+	})
+	var afterResult any
+	var afterMap map[string]any
+	state.OnAfterFunctionCall = func(callback *CallbackAfterFunctionCall) (map[string]any, *gut.ErrorInstance) {
+		afterResult = callback.Value
+		afterMap = callback.Result
+		return nil, nil
+	}
+
+	_, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	toolCall := state.ToolMessages[0].ToolCalls[0]
+	assert.JSONEq(t, `{"width":640,"height":480}`, string(toolCall.Result))
+	assert.Len(t, toolCall.Parts, 1)
+	assert.Equal(t, "image/png", *toolCall.Parts[0].MediaType)
+	assert.IsType(t, new(Result), afterResult)
+	assert.Nil(t, afterMap)
+}
+
+func TestCallResultLimit(t *testing.T) {
+	content := strings.Repeat("0123456789", 20)
+	responses := []*call.Response{
+		CallerStubToolResponse("1", "read_file", "{}"),
+		CallerStubToolResponse("2", "read_artifact", `{"id": "read_file_1", "offset": 100}`),
+		CallerStubTextResponse("done"),
+	}
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			return responses[len(request.Messages)-1]
+		},
+	}
+	functionCall := New(caller, &Option{
+		ToolResultLimit:    gut.Ptr(64),
+		ToolResultOverflow: gut.Ptr(ResultOverflowArtifact),
+		ArtifactStore:      NewArtifactMemory(),
+	})
+	functionCall.AddDeclaration(NewDeclarationResult(
+		gut.Ptr("read_file"),
+		gut.Ptr("Read a file"),
+		func(ctx *DeclarationContext, arguments *struct{}) (string, *gut.ErrorInstance) {
+			return content, nil
+		},
+	))
+	truncated := NewDeclarationResult(
+		gut.Ptr("read_head"),
+		gut.Ptr("Read head of a file"),
+		func(ctx *DeclarationContext, arguments *struct{}) (string, *gut.ErrorInstance) {
+			return content, nil
+		},
+	)
+	truncated.ResultOverflow = gut.Ptr(ResultOverflowTruncate)
+	functionCall.AddDeclaration(truncated)
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Read the file")},
+	})
+
+	_, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Len(t, caller.Requests[0].Tools, 3)
+	assert.Equal(t, "read_artifact", *caller.Requests[0].Tools[2].Name)
+
+	envelope := make(map[string]any)
+	assert.Nil(t, json.Unmarshal(state.ToolMessages[0].ToolCalls[0].Result, &envelope))
+	assert.Equal(t, "read_file_1", envelope["artifact"])
+	assert.Equal(t, float64(len(content)+2), envelope["size"])
+
+	page := make(map[string]any)
+	assert.Nil(t, json.Unmarshal(state.ToolMessages[1].ToolCalls[0].Result, &page))
+	assert.Equal(t, content[99:163], page["content"])
+	assert.Equal(t, false, page["done"])
+
+	t.Run("Truncate", func(t *testing.T) {
+		toolCall := &call.ToolCall{Name: gut.Ptr("read_head")}
+		result := functionCall.(*Call).Limit(NewState(nil), truncated, toolCall, []byte(strconv.Quote(content)))
+
+		envelope := make(map[string]any)
+		assert.Nil(t, json.Unmarshal(result, &envelope))
+		assert.Equal(t, "\""+content[:63], envelope["truncated"])
+	})
+
+	t.Run("DeclarationArtifact", func(t *testing.T) {
+		functionCall := New(caller, &Option{ArtifactStore: NewArtifactMemory()}).(*Call)
+		declaration := NewDeclaration(gut.Ptr("read_file"), gut.Ptr("Read a file"), func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+			return nil, nil
+		})
+		functionCall.AddDeclaration(declaration)
+		assert.Len(t, functionCall.Available(), 1)
+
+		declaration.ResultLimit = gut.Ptr(32)
+		declaration.ResultOverflow = gut.Ptr(ResultOverflowArtifact)
+		assert.Len(t, functionCall.Available(), 2)
+		assert.Equal(t, 32, functionCall.ArtifactLength())
+	})
+
+	t.Run("RuneBoundary", func(t *testing.T) {
+		store := NewArtifactMemory()
+		id, _ := store.Put(gut.Ptr("read_file"), []byte("aéb"))
+		reader := NewArtifactReader(store, 2)
+
+		first, err := reader.FuncContext(nil, &ArtifactReadArguments{Id: id, Offset: gut.Ptr(0)})
+		assert.Nil(t, err)
+		assert.Equal(t, "a", first.(map[string]any)["content"])
+		assert.Equal(t, 1, first.(map[string]any)["next"])
+
+		second, err := reader.FuncContext(nil, &ArtifactReadArguments{Id: id, Offset: gut.Ptr(2), Length: gut.Ptr(1)})
+		assert.Nil(t, err)
+		assert.Equal(t, "é", second.(map[string]any)["content"])
+		assert.Equal(t, 3, second.(map[string]any)["next"])
+	})
+
+	t.Run("SummaryPrompt", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				return CallerStubTextResponse("summary")
+			},
+		}
+		functionCall := New(caller, &Option{}).(*Call)
+		summary, err := functionCall.LimitSummary(NewState(nil), &call.ToolCall{Name: gut.Ptr("read_file")}, []byte(content), 64)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "summary", *summary)
+		assert.Len(t, caller.Requests[0].Messages, 1)
+		assert.Contains(t, *caller.Requests[0].Messages[0].(*call.UserMessage).Content, "64 bytes")
+	})
+}
+
+func TestCallToolSelector(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return CallerStubToolResponse("1", "search_tools", `{"query": "stock price"}`)
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	functionCall := New(caller, &Option{
+		ToolSelector: &ToolSelectorKeyword{Limit: 1},
+		ToolSearch:   gut.Ptr(true),
+	})
+	for _, name := range []string{"current_weather", "stock_price", "send_email"} {
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr(name),
+			gut.Ptr("Get "+strings.ReplaceAll(name, "_", " ")),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				return map[string]any{}, nil
+			},
+		))
+	}
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("What is the weather in Paris? Also check how ACME shares are doing.")},
+	})
+
+	_, err := functionCall.Call(state, nil)
+
+	names := func(tools []*call.Tool) []string {
+		result := make([]string, 0)
+		for _, tool := range tools {
+			result = append(result, *tool.Name)
+		}
+		return result
+	}
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"current_weather", "search_tools"}, names(caller.Requests[0].Tools))
+	assert.Equal(t, []string{"current_weather", "stock_price", "search_tools"}, names(caller.Requests[1].Tools))
+	assert.Equal(t, []string{"stock_price"}, state.Discovered)
+
+	t.Run("Source", func(t *testing.T) {
+		declarations := []*Declaration{
+			{Name: gut.Ptr("a"), Source: gut.Ptr("github")},
+			{Name: gut.Ptr("b"), Source: gut.Ptr("slack")},
+			{Name: gut.Ptr("c")},
+		}
+		selected := (&ToolSelectorSource{Sources: []string{"slack", ""}}).Select(&ToolSelection{Declarations: declarations})
+		assert.Equal(t, declarations[1:], selected)
+	})
+
+	t.Run("KeywordFallback", func(t *testing.T) {
+		declarations := functionCall.(*Call).Declarations
+		selected := (&ToolSelectorKeyword{Limit: 1}).Select(&ToolSelection{
+			Messages:     []call.Message{&call.UserMessage{Content: gut.Ptr("Hello there")}},
+			Declarations: declarations,
+		})
+		assert.Equal(t, declarations, selected)
+	})
+
+	t.Run("EmbeddingConcurrent", func(t *testing.T) {
+		selector := &ToolSelectorEmbedding{
+			Embed: func(texts []string) ([][]float64, *gut.ErrorInstance) {
+				vectors := make([][]float64, len(texts))
+				for i, text := range texts {
+					vectors[i] = []float64{float64(len(text)), 1}
+				}
+				return vectors, nil
+			},
+			Limit: 2,
+		}
+		group := new(sync.WaitGroup)
+		for i := 0; i < 8; i++ {
+			group.Add(1)
+			go func() {
+				defer group.Done()
+				selected := selector.Select(&ToolSelection{
+					Messages:     state.Messages(),
+					Declarations: functionCall.(*Call).Declarations,
+				})
+				assert.Len(t, selected, 2)
+			}()
+		}
+		group.Wait()
+	})
+
+	t.Run("BuiltinOnce", func(t *testing.T) {
+		assert.Same(t, functionCall.(*Call).Available()[3], functionCall.(*Call).Available()[3])
+	})
+}
+
+func TestCallArgumentsRepair(t *testing.T) {
+	type Arguments struct {
+		Count *int      `json:"count"`
+		Tags  []*string `json:"tags"`
+	}
+
+	responses := []*call.Response{
+		CallerStubToolResponse("1", "lenient", `{'count': "5", "tags": "a",}`),
+		CallerStubToolResponse("2", "strict", `{"count": "5"}`),
+		CallerStubTextResponse("done"),
+	}
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			return responses[len(request.Messages)-1]
+		},
+	}
+	functionCall := New(caller, &Option{})
+	received := make([]*Arguments, 0)
+	function := func(arguments *Arguments) (map[string]any, *gut.ErrorInstance) {
+		received = append(received, arguments)
+		return map[string]any{}, nil
+	}
+	functionCall.AddDeclaration(NewDeclaration(gut.Ptr("lenient"), gut.Ptr("Lenient"), function))
+	strict := NewDeclaration(gut.Ptr("strict"), gut.Ptr("Strict"), function)
+	strict.Strict = gut.Ptr(true)
+	functionCall.AddDeclaration(strict)
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Count")},
+	})
+	var repairs []string
+	state.OnBeforeFunctionCall = func(callback *CallbackBeforeFunctionCall) (any, *gut.ErrorInstance) {
+		repairs = append(repairs, callback.Repairs...)
+		return nil, nil
+	}
+
+	_, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Len(t, received, 1)
+	assert.Equal(t, 5, *received[0].Count)
+	assert.Equal(t, "a", *received[0].Tags[0])
+	assert.Len(t, repairs, 3)
+	assert.Contains(t, *state.ToolMessages[1].ToolCalls[0].Error, "failed to unmarshal arguments")
+}
+
+func TestCallCache(t *testing.T) {
+	type Arguments struct {
+		Path *string `json:"path"`
+	}
+
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) < 3 {
+				return CallerStubToolResponse(fmt.Sprint(len(request.Messages)), "read_file", `{"path": "a.txt"}`)
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	store := NewCacheMemory()
+	functionCall := New(caller, &Option{
+		CacheStore: store,
+	})
+	executions := 0
+	declaration := NewDeclaration(
+		gut.Ptr("read_file"),
+		gut.Ptr("Read a file"),
+		func(arguments *Arguments) (map[string]any, *gut.ErrorInstance) {
+			executions++
+			return map[string]any{"content": "hello"}, nil
+		},
+	)
+	declaration.Cache = gut.Ptr(true)
+	declaration.CacheTtl = gut.Ptr(time.Minute)
+	functionCall.AddDeclaration(declaration)
+	cached := make([]bool, 0)
+	newState := func() *State {
+		state := NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Read a.txt twice")},
+		})
+		state.OnAfterFunctionCall = func(callback *CallbackAfterFunctionCall) (map[string]any, *gut.ErrorInstance) {
+			cached = append(cached, gut.Val(callback.Cached))
+			return nil, nil
+		}
+		return state
+	}
+
+	// * repeated call within a run is answered from state cache
+	state := newState()
+	_, err := functionCall.Call(state, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, executions)
+	assert.Equal(t, []bool{false, true}, cached)
+	assert.JSONEq(t, `{"content":"hello"}`, string(state.ToolMessages[1].ToolCalls[0].Result))
+	assert.Len(t, state.Cache, 1)
+
+	// * following run is answered from shared cache store
+	caller.Requests = nil
+	_, err = functionCall.Call(newState(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, executions)
+	assert.Equal(t, []bool{false, true, true, true}, cached)
+}
+
+func TestCallToolError(t *testing.T) {
+	type Arguments struct {
+		Order *string `json:"order" validate:"required"`
+	}
+
+	responses := []*call.Response{
+		CallerStubToolResponse("1", "refund_ordr", `{}`),
+		CallerStubToolResponse("2", "refund_order", `{}`),
+		CallerStubToolResponse("3", "refund_order", `{"order": "A1"}`),
+		CallerStubTextResponse("done"),
+	}
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			return responses[len(request.Messages)-1]
+		},
+	}
+	functionCall := New(caller, &Option{})
+	functionCall.AddDeclaration(NewDeclaration(
+		gut.Ptr("refund_order"),
+		gut.Ptr("Refund an order"),
+		func(arguments *Arguments) (map[string]any, *gut.ErrorInstance) {
+			return nil, NewToolError(ToolErrorKindExecutionFailed, "order is already refunded", false, "tell the user the order was refunded before")
+		},
+	))
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Refund order A1")},
+	})
+
+	_, err := functionCall.Call(state, nil)
+	assert.Nil(t, err)
+
+	unknown := ToolErrorParse(state.ToolMessages[0].ToolCalls[0].Error)
+	assert.Equal(t, ToolErrorKindUnknownTool, unknown.Kind)
+	assert.Equal(t, []string{"refund_order"}, unknown.Tools)
+
+	invalid := ToolErrorParse(state.ToolMessages[1].ToolCalls[0].Error)
+	assert.Equal(t, ToolErrorKindInvalidArguments, invalid.Kind)
+	assert.True(t, invalid.Retryable)
+	assert.NotNil(t, invalid.Schema)
+
+	execution := ToolErrorParse(state.ToolMessages[2].ToolCalls[0].Error)
+	assert.Equal(t, ToolErrorKindExecutionFailed, execution.Kind)
+	assert.Equal(t, "order is already refunded", execution.Message)
+	assert.Equal(t, []string{"tell the user the order was refunded before"}, execution.Hints)
+	assert.Equal(t, "refund_order", *execution.Tool)
+}
+
+func TestToolClosest(t *testing.T) {
+	declarations := []*Declaration{
+		{Name: gut.Ptr("refund_order")},
+		{Name: gut.Ptr("GetWeather")},
+		{Name: gut.Ptr("ping")},
+	}
+
+	assert.Empty(t, ToolClosest(declarations, "", 3))
+	assert.Equal(t, []string{"GetWeather"}, ToolClosest(declarations, "weather", 3))
+	assert.Equal(t, []string{"refund_order"}, ToolClosest(declarations, "REFUND", 3))
+}
+
+func TestCallRetry(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				return CallerStubToolResponse("1", "fetch", "{}")
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	functionCall := New(caller, &Option{})
+	calls := 0
+	declaration := NewDeclaration(
+		gut.Ptr("fetch"),
+		gut.Ptr("Fetch a page"),
+		func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+			calls++
+			if calls < 3 {
+				return nil, gut.Err(false, "connection reset")
+			}
+			return map[string]any{"status": 200}, nil
+		},
+	)
+	declaration.Retry = &RetryPolicy{
+		Attempts: gut.Ptr(3),
+		Backoff:  gut.Ptr(time.Millisecond),
+	}
+	functionCall.AddDeclaration(declaration)
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Fetch the page")},
+	})
+	attempts := make([]int, 0)
+	state.OnAfterFunctionCall = func(callback *CallbackAfterFunctionCall) (map[string]any, *gut.ErrorInstance) {
+		attempts = append(attempts, *callback.Attempt)
+		return nil, nil
+	}
+
+	_, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.JSONEq(t, `{"status":200}`, string(state.ToolMessages[0].ToolCalls[0].Result))
+	assert.Len(t, caller.Requests, 2)
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		calls = 0
+		declaration.FuncContext = func(ctx *DeclarationContext, arguments any) (any, *gut.ErrorInstance) {
+			calls++
+			return nil, NewToolError(ToolErrorKindExecutionFailed, "not found", false)
+		}
+		caller.Requests = nil
+
+		_, err := functionCall.Call(NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Fetch the page")},
+		}), nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		policy := &RetryPolicy{
+			Backoff:    gut.Ptr(10 * time.Millisecond),
+			BackoffMax: gut.Ptr(30 * time.Millisecond),
+		}
+		assert.Equal(t, 10*time.Millisecond, policy.Delay(1))
+		assert.Equal(t, 20*time.Millisecond, policy.Delay(2))
+		assert.Equal(t, 30*time.Millisecond, policy.Delay(3))
+	})
+
+	t.Run("DefaultDelay", func(t *testing.T) {
+		policy := &RetryPolicy{Attempts: gut.Ptr(3)}
+		assert.Equal(t, RetryBackoff, policy.Delay(1))
+		assert.Equal(t, 2*RetryBackoff, policy.Delay(2))
+	})
+
+	t.Run("CallbackError", func(t *testing.T) {
+		calls = 0
+		declaration.FuncContext = func(ctx *DeclarationContext, arguments any) (any, *gut.ErrorInstance) {
+			calls++
+			return nil, gut.Err(false, "connection reset")
+		}
+		state := NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Fetch the page")},
+		})
+		state.OnAfterFunctionCall = func(callback *CallbackAfterFunctionCall) (map[string]any, *gut.ErrorInstance) {
+			return nil, gut.Err(false, "stop retrying")
+		}
+
+		_, err := functionCall.Call(state, nil)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "stop retrying")
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, state.ToolMessages)
+	})
+}
+
+func TestCallLoopDetection(t *testing.T) {
+	newCall := func(caller call.Caller, detection *LoopDetection) Caller {
+		functionCall := New(caller, &Option{
+			MaxTurns:      gut.Ptr(6),
+			LoopDetection: detection,
+		})
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr("status"),
+			gut.Ptr("Check job status"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				return map[string]any{"status": "running"}, nil
+			},
+		))
+		return functionCall
+	}
+	newState := func() *State {
+		return NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Wait for the job")},
+		})
+	}
+
+	t.Run("Nudge", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				if _, ok := request.Messages[len(request.Messages)-1].(*call.UserMessage); ok && len(request.Messages) > 1 {
+					return CallerStubTextResponse("giving up")
+				}
+				return CallerStubToolResponse("1", "status", "{}")
+			},
+		}
+
+		response, err := newCall(caller, &LoopDetection{Repeat: gut.Ptr(3)}).Call(newState(), nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "giving up", *response.Message.Content)
+		assert.Len(t, caller.Requests, 4)
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				return CallerStubToolResponse("1", "status", "{}")
+			},
+		}
+
+		_, err := newCall(caller, &LoopDetection{
+			Stall:  gut.Ptr(2),
+			Action: gut.Ptr(LoopActionAbort),
+		}).Call(newState(), nil)
+
+		loopError := LoopErrorOf(err)
+		assert.NotNil(t, loopError)
+		assert.Equal(t, LoopKindStall, loopError.Kind)
+		assert.Len(t, caller.Requests, 3)
+	})
+
+	t.Run("RepeatBeyondWindow", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				return CallerStubToolResponse("1", "status", "{}")
+			},
+		}
+
+		_, err := newCall(caller, &LoopDetection{
+			Repeat: gut.Ptr(4),
+			Window: gut.Ptr(2),
+			Action: gut.Ptr(LoopActionAbort),
+		}).Call(newState(), nil)
+
+		loopError := LoopErrorOf(err)
+		assert.NotNil(t, loopError)
+		assert.Equal(t, LoopKindRepeat, loopError.Kind)
+		assert.Len(t, caller.Requests, 4)
+	})
+
+	t.Run("ToolChoice", func(t *testing.T) {
+		caller := &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				if request.ToolChoice != nil {
+					return CallerStubTextResponse("done")
+				}
+				return CallerStubToolResponse("1", "missing", "{}")
+			},
+		}
+
+		_, err := newCall(caller, &LoopDetection{
+			Errors: gut.Ptr(2),
+			Action: gut.Ptr(LoopActionToolChoice),
+		}).Call(newState(), nil)
+
+		assert.Nil(t, err)
+		assert.Len(t, caller.Requests, 3)
+		assert.Equal(t, call.ToolChoiceModeNone, *caller.Requests[2].ToolChoice.Mode)
+	})
+}
+
+func TestCallCheckpoint(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				batch := CallerStubToolResponse("1", "fetch", `{}`)
+				batch.Message.ToolCalls = append(batch.Message.ToolCalls,
+					CallerStubToolResponse("2", "crash", `{}`).Message.ToolCalls[0],
+				)
+				return batch
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	store := NewStateFile(t.TempDir())
+	fetches := 0
+	crashes := 0
+	newCall := func(cancel context.CancelFunc) Caller {
+		functionCall := New(caller, &Option{
+			StateStore: store,
+		})
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr("fetch"),
+			gut.Ptr("Fetch data"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				fetches++
+				return map[string]any{"data": "fetched"}, nil
+			},
+		))
+		functionCall.AddDeclaration(NewDeclarationContext(
+			gut.Ptr("crash"),
+			gut.Ptr("Crash the process on first run"),
+			func(ctx *DeclarationContext, arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				crashes++
+				if cancel != nil {
+					cancel()
+					<-ctx.Done()
+				}
+				return map[string]any{"crashed": false}, nil
+			},
+		))
+		return functionCall
+	}
+	newState := func() *State {
+		state := NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Fetch and crash")},
+		})
+		state.Id = gut.Ptr("run/1")
+		return state
+	}
+
+	// * first run is interrupted while executing the second tool call
+	ctx, cancel := context.WithCancel(context.Background())
+	state := newState()
+	state.Context = ctx
+	response, err := newCall(cancel).Call(state, nil)
+	assert.Nil(t, response)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// * second run in a fresh state resumes the interrupted turn without repeating completed tool calls
+	restored := newState()
+	response, err = newCall(nil).Call(restored, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+	assert.Equal(t, 1, fetches)
+	assert.Equal(t, 2, crashes)
+	assert.Len(t, caller.Requests, 2)
+	assert.False(t, restored.Suspended())
+	assert.Len(t, restored.ToolMessages, 1)
+
+	// * checkpoint of the completed run is deleted so a rerun starts over
+	found, loadErr := store.Load("run/1", NewState(nil))
+	assert.Nil(t, loadErr)
+	assert.False(t, found)
+	response, err = newCall(nil).Call(newState(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+	assert.Equal(t, 2, fetches)
+	assert.Len(t, caller.Requests, 4)
+}
+
+func TestCallCheckpointConcurrent(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 1 {
+				batch := CallerStubToolResponse("1", "fetch", `{}`)
+				batch.Message.ToolCalls = append(batch.Message.ToolCalls,
+					CallerStubToolResponse("2", "crash", `{}`).Message.ToolCalls[0],
+					CallerStubToolResponse("3", "audit", `{}`).Message.ToolCalls[0],
+				)
+				return batch
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	store := NewStateFile(t.TempDir())
+	fetches := 0
+	audits := 0
+	newCall := func(cancel context.CancelFunc) Caller {
+		functionCall := New(caller, &Option{
+			StateStore:      store,
+			ToolConcurrency: gut.Ptr(2),
+		})
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr("fetch"),
+			gut.Ptr("Fetch data"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				fetches++
+				return map[string]any{"data": "fetched"}, nil
+			},
+		))
+		functionCall.AddDeclaration(NewDeclarationContext(
+			gut.Ptr("crash"),
+			gut.Ptr("Crash the process once the fetch is checkpointed"),
+			func(ctx *DeclarationContext, arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				if cancel != nil {
+					assert.Eventually(t, func() bool {
+						checkpoint := NewState(nil)
+						found, _ := store.Load("run/1", checkpoint)
+						return found && checkpoint.Pending != nil && checkpoint.Pending.ToolCalls[0].Result != nil
+					}, time.Second, time.Millisecond)
+					cancel()
+					<-ctx.Done()
+				}
+				return map[string]any{"crashed": false}, nil
+			},
+		))
+		audit := NewDeclaration(
+			gut.Ptr("audit"),
+			gut.Ptr("Audit the batch"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				audits++
+				return map[string]any{"audited": true}, nil
+			},
+		)
+		audit.Serial = gut.Ptr(true)
+		functionCall.AddDeclaration(audit)
+		return functionCall
+	}
+	newState := func() *State {
+		state := NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Fetch, crash and audit")},
+		})
+		state.Id = gut.Ptr("run/1")
+		return state
+	}
+
+	// * first run is interrupted mid-batch after the concurrent fetch is checkpointed, the serial audit never runs
+	ctx, cancel := context.WithCancel(context.Background())
+	state := newState()
+	state.Context = ctx
+	_, err := newCall(cancel).Call(state, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, fetches)
+	assert.Equal(t, 0, audits)
+
+	// * second run resumes without repeating the finished concurrent call
+	restored := newState()
+	response, err := newCall(nil).Call(restored, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+	assert.Equal(t, 1, fetches)
+	assert.Equal(t, 1, audits)
+	assert.Len(t, caller.Requests, 2)
+}
+
+func TestCallCompaction(t *testing.T) {
+	turns := []*call.Response{
+		CallerStubToolResponse("1", "fetch", `{}`),
+		CallerStubToolResponse("2", "pin", `{}`),
+		CallerStubToolResponse("3", "fetch", `{}`),
+		CallerStubTextResponse("done"),
+	}
+	turn := 0
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if request.Tools == nil {
+				return CallerStubTextResponse("fetched once")
+			}
+			turn++
+			return turns[turn-1]
+		},
+	}
+	functionCall := New(caller, &Option{
+		Compaction: &Compaction{
+			Window: gut.Ptr(1),
+			Keep:   gut.Ptr(1),
+			Pin: func(message *call.AssistantMessage) bool {
+				return *message.ToolCalls[0].Name == "pin"
+			},
+		},
+	})
+	for _, name := range []string{"fetch", "pin"} {
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr(name),
+			gut.Ptr("Tool "+name),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				return map[string]any{"ok": true}, nil
+			},
+		))
+	}
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Fetch data")},
+	})
+
+	response, err := functionCall.Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+
+	// * first tool message is summarised, pinned and most recent tool messages are kept
+	assert.Len(t, caller.Requests, 5)
+	assert.Contains(t, *caller.Requests[2].Messages[1].(*call.UserMessage).Content, "Name: fetch")
+	assert.Equal(t, 1, state.Summary.Messages)
+	assert.Equal(t, "fetched once", *state.Summary.Content)
+	assert.Len(t, state.ToolMessages, 2)
+	assert.Equal(t, "2", *state.ToolMessages[0].ToolCalls[0].Id)
+	assert.Equal(t, "3", *state.ToolMessages[1].ToolCalls[0].Id)
+	final := caller.Requests[4].Messages
+	assert.Contains(t, *final[1].(*call.UserMessage).Content, "fetched once")
+	assert.Len(t, final, 4)
+
+	// * usage of compacted messages and summary call stays in total usage
+	assert.Equal(t, int64(50), *response.TotalUsage.InputTokens)
+
+	t.Run("PinnedPrefix", func(t *testing.T) {
+		compaction := &Compaction{
+			Keep: gut.Ptr(1),
+			Pin: func(message *call.AssistantMessage) bool {
+				return *message.ToolCalls[0].Name == "pin"
+			},
+		}
+		toolMessages := []*call.AssistantMessage{
+			CallerStubToolResponse("1", "fetch", `{}`).Message,
+			CallerStubToolResponse("2", "fetch", `{}`).Message,
+			CallerStubToolResponse("3", "pin", `{}`).Message,
+			CallerStubToolResponse("4", "fetch", `{}`).Message,
+			CallerStubToolResponse("5", "fetch", `{}`).Message,
+		}
+
+		assert.Equal(t, []int{0, 1}, compaction.Compactable(toolMessages))
+		assert.Empty(t, compaction.Compactable(toolMessages[2:]))
+	})
+
+	t.Run("RequiredWindow", func(t *testing.T) {
+		functionCall := New(caller, &Option{
+			Compaction: &Compaction{
+				Keep: gut.Ptr(1),
+			},
+		})
+
+		_, err := functionCall.Call(NewState(nil), nil)
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "window")
+	})
+
+	t.Run("CallOption", func(t *testing.T) {
+		summarizer := &CallerStubOption{CallerStub: &CallerStub{
+			Respond: func(request *call.Request) *call.Response {
+				return CallerStubTextResponse("summary")
+			},
+		}}
+		functionCall := New(caller, &Option{
+			Compaction: &Compaction{
+				Window: gut.Ptr(1),
+				Keep:   gut.Ptr(0),
+				Caller: summarizer,
+			},
+		}).(*Call)
+		state := NewState(nil)
+		state.ToolMessages = append(state.ToolMessages, CallerStubToolResponse("1", "fetch", `{}`).Message)
+
+		err := functionCall.Compact(state, &call.Request{Messages: state.Messages()})
+
+		assert.Nil(t, err)
+		assert.Len(t, summarizer.Requests, 1)
+		assert.Equal(t, "summary", *state.Summary.Content)
+	})
+}
+
+// CallerStubOption rejects calls without a call option, like provider callers reading option fields
+type CallerStubOption struct {
+	*CallerStub
+}
+
+func (r *CallerStubOption) Call(request *call.Request, option *call.Option, output any) (*call.Response, *gut.ErrorInstance) {
+	if option == nil {
+		return nil, gut.Err(false, "call option is required")
+	}
+	return r.CallerStub.Call(request, option, output)
+}
+
+func TestCallLifecycle(t *testing.T) {
+	caller := &CallerStub{
+		Respond: func(request *call.Request) *call.Response {
+			if len(request.Messages) == 2 {
+				return CallerStubToolResponse("1", "ping", `{}`)
+			}
+			return CallerStubTextResponse("done")
+		},
+	}
+	newCall := func(option *Option) Caller {
+		functionCall := New(caller, option)
+		functionCall.AddDeclaration(NewDeclaration(
+			gut.Ptr("ping"),
+			gut.Ptr("Ping"),
+			func(arguments *struct{}) (map[string]any, *gut.ErrorInstance) {
+				return map[string]any{"pong": true}, nil
+			},
+		))
+		return functionCall
+	}
+	events := make([]string, 0)
+	parent := NewState(nil)
+	parent.OnTurnStart = func(state *State, turn int) *gut.ErrorInstance {
+		events = append(events, fmt.Sprintf("turn %d %s", turn, gut.Val(state.Id)))
+		return nil
+	}
+	parent.OnRequest = func(state *State, turn int, request *call.Request) *gut.ErrorInstance {
+		events = append(events, fmt.Sprintf("request %d", turn))
+		if turn == 0 {
+			request.Temperature = gut.Ptr(0.5)
+		}
+		request.Messages = append(request.Messages, &call.SystemMessage{Content: gut.Ptr("Be brief")})
+		return nil
+	}
+	parent.OnResponse = func(state *State, turn int, response *call.Response) *gut.ErrorInstance {
+		events = append(events, fmt.Sprintf("response %d %s", turn, response.FinishReason))
+		return nil
+	}
+	parent.OnEnd = func(state *State, response *call.Response) {
+		events = append(events, fmt.Sprintf("end %d %s", *response.TotalUsage.InputTokens, gut.Val(state.Id)))
+	}
+	parent.OnError = func(state *State, err *gut.ErrorInstance) {
+		events = append(events, "error "+gut.Val(state.Id))
+	}
+
+	// * hooks inherited by a subagent state observe the whole lifecycle
+	state := NewState([]call.Message{
+		&call.UserMessage{Content: gut.Ptr("Ping")},
+	})
+	state.Id = gut.Ptr("parent/agent/1")
+	state.Inherit(parent)
+	response, err := newCall(&Option{}).Call(state, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "done", *response.Message.Content)
+	assert.Equal(t, []string{
+		"turn 0 parent/agent/1", "request 0", "response 0 tool_calls",
+		"turn 1 parent/agent/1", "request 1", "response 1 stop",
+		"end 20 parent/agent/1",
+	}, events)
+	assert.Equal(t, 0.5, *caller.Requests[0].Temperature)
+	assert.Nil(t, caller.Requests[1].Temperature)
+	assert.Equal(t, "Be brief", *caller.Requests[0].Messages[1].(*call.SystemMessage).Content)
+
+	t.Run("Error", func(t *testing.T) {
+		events = events[:0]
+		state := NewState([]call.Message{
+			&call.UserMessage{Content: gut.Ptr("Ping")},
+		})
+		state.Inherit(parent)
+
+		response, err := newCall(&Option{MaxTurns: gut.Ptr(1)}).Call(state, nil)
+
+		assert.Nil(t, response)
+		assert.NotNil(t, err)
+		assert.Equal(t, []string{"turn 0 ", "request 0", "response 0 tool_calls", "error "}, events)
+	})
+}
+
+// CallerStubToolResponse creates a response calling a tool with arguments
+func CallerStubToolResponse(id string, name string, arguments string) *call.Response {
+	return &call.Response{
+		FinishReason: "tool_calls",
+		Message: &call.AssistantMessage{
+			ToolCalls: []*call.ToolCall{
+				{
+					Id:        gut.Ptr(id),
+					Type:      gut.Ptr("function"),
+					Name:      gut.Ptr(name),
+					Arguments: []byte(arguments),
+				},
+			},
+			Usage: &call.Usage{
+				InputTokens:  gut.Ptr[int64](10),
+				OutputTokens: gut.Ptr[int64](5),
+			},
+		},
+	}
+}
+
+// CallerStubTextResponse creates a final response with content
+func CallerStubTextResponse(content string) *call.Response {
+	return &call.Response{
+		FinishReason: "stop",
+		Message: &call.AssistantMessage{
+			Content: gut.Ptr(content),
+			Usage: &call.Usage{
+				InputTokens:  gut.Ptr[int64](10),
+				OutputTokens: gut.Ptr[int64](5),
+			},
+		},
+	}
+}
@@ -1,13 +1,52 @@
 package function
 
+import (
+	"encoding/json"
+)
+
 type CallbackBeforeFunctionCall struct {
 	ToolCallId  *string      `json:"toolCallId"`
 	Declaration *Declaration `json:"declaration"`
 	Arguments   any          `json:"arguments"`
+	Repairs     []string     `json:"repairs,omitempty"`
+	Cached      *bool        `json:"cached,omitempty"`
+	Attempt     *int         `json:"attempt,omitempty"`
 }
 
+// CallbackAfterFunctionCall holds the function result as a map in result when the function returns a map,
+// value holds the result as returned by the function for any result type, including *Result with content parts
 type CallbackAfterFunctionCall struct {
 	CallbackBeforeFunctionCall
 	Result map[string]any `json:"result"`
+	Value  any            `json:"value,omitempty"`
 	Error  *string        `json:"error,omitempty"`
 }
+
+// CallbackResult returns the map form of a function result for after function call callbacks,
+// unwrapping *Result values and decoding cached json results, or nil when the result is not a map
+func CallbackResult(response any) map[string]any {
+	if result, ok := response.(*Result); ok && result != nil {
+		response = result.Value
+	}
+	switch value := response.(type) {
+	case map[string]any:
+		return value
+	case json.RawMessage:
+		var result map[string]any
+		if err := json.Unmarshal(value, &result); err != nil {
+			return nil
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// CallbackAlter replaces the value of a function result with the map returned by an after function call callback,
+// content parts of *Result values are kept
+func CallbackAlter(response any, alter map[string]any) any {
+	if result, ok := response.(*Result); ok && result != nil {
+		return NewResult(alter, result.Parts...)
+	}
+	return alter
+}
@@ -0,0 +1,170 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bsthun/gut"
+)
+
+// StateStore persists checkpoints of function calling states by state id
+type StateStore interface {
+	// Save stores the checkpoint of state under id, replacing the previous checkpoint
+	Save(id string, state *State) *gut.ErrorInstance
+	// Load reads the checkpoint of id into state, returning false when missing
+	Load(id string, state *State) (bool, *gut.ErrorInstance)
+	// Delete removes the checkpoint of id
+	Delete(id string) *gut.ErrorInstance
+}
+
+// StateMemory is an in-memory state store scoped to the process
+type StateMemory struct {
+	mutex       sync.Mutex
+	checkpoints map[string][]byte
+}
+
+func NewStateMemory() *StateMemory {
+	return &StateMemory{
+		checkpoints: make(map[string][]byte),
+	}
+}
+
+func (r *StateMemory) Save(id string, state *State) *gut.ErrorInstance {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return gut.Err(false, "failed to marshal state checkpoint", err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.checkpoints[id] = content
+	return nil
+}
+
+func (r *StateMemory) Load(id string, state *State) (bool, *gut.ErrorInstance) {
+	r.mutex.Lock()
+	content, ok := r.checkpoints[id]
+	r.mutex.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return false, gut.Err(false, "failed to unmarshal state checkpoint", err)
+	}
+	return true, nil
+}
+
+func (r *StateMemory) Delete(id string) *gut.ErrorInstance {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.checkpoints, id)
+	return nil
+}
+
+// StateFile is a state store writing each checkpoint as a json file in a directory,
+// checkpoints are written to a temporary file and renamed so a crash never leaves a partial checkpoint
+type StateFile struct {
+	Directory string
+}
+
+func NewStateFile(directory string) *StateFile {
+	return &StateFile{
+		Directory: directory,
+	}
+}
+
+// Path returns the checkpoint file path of id, escaping id so subagent ids containing slashes stay in the directory
+func (r *StateFile) Path(id string) string {
+	return filepath.Join(r.Directory, url.PathEscape(id)+".json")
+}
+
+func (r *StateFile) Save(id string, state *State) *gut.ErrorInstance {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return gut.Err(false, "failed to marshal state checkpoint", err)
+	}
+	if err := os.MkdirAll(r.Directory, 0o755); err != nil {
+		return gut.Err(false, "failed to create checkpoint directory", err)
+	}
+
+	// * write temporary file then rename over the previous checkpoint
+	file, err := os.CreateTemp(r.Directory, url.PathEscape(id)+".*.tmp")
+	if err != nil {
+		return gut.Err(false, "failed to create checkpoint file", err)
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return gut.Err(false, "failed to write checkpoint file", err)
+	}
+	if err := os.Rename(file.Name(), r.Path(id)); err != nil {
+		_ = os.Remove(file.Name())
+		return gut.Err(false, "failed to replace checkpoint file", err)
+	}
+
+	return nil
+}
+
+func (r *StateFile) Load(id string, state *State) (bool, *gut.ErrorInstance) {
+	content, err := os.ReadFile(r.Path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, gut.Err(false, "failed to read checkpoint file", err)
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return false, gut.Err(false, "failed to unmarshal state checkpoint", err)
+	}
+	return true, nil
+}
+
+func (r *StateFile) Delete(id string) *gut.ErrorInstance {
+	if err := os.Remove(r.Path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return gut.Err(false, "failed to delete checkpoint file", err)
+	}
+	return nil
+}
+
+// Checkpoint saves state to the option state store when both the store and the state id are set
+func (r *Call) Checkpoint(state *State) *gut.ErrorInstance {
+	if r.Option.StateStore == nil || state.Id == nil {
+		return nil
+	}
+	if err := r.Option.StateStore.Save(*state.Id, state); err != nil {
+		return gut.Err(false, "failed to save checkpoint of state "+*state.Id, err)
+	}
+	return nil
+}
+
+// Complete deletes the checkpoint of a state whose run has completed
+func (r *Call) Complete(state *State) *gut.ErrorInstance {
+	if r.Option.StateStore == nil || state.Id == nil {
+		return nil
+	}
+	if err := r.Option.StateStore.Delete(*state.Id); err != nil {
+		return gut.Err(false, "failed to delete checkpoint of state "+*state.Id, err)
+	}
+	return nil
+}
+
+// Restore loads the last checkpoint into a fresh state, a state with tool messages or a pending turn is kept as is
+// so approvals set on a suspended state are not overwritten
+func (r *Call) Restore(state *State) *gut.ErrorInstance {
+	if r.Option.StateStore == nil || state.Id == nil {
+		return nil
+	}
+	if len(state.ToolMessages) > 0 || state.Pending != nil {
+		return nil
+	}
+	if _, err := r.Option.StateStore.Load(*state.Id, state); err != nil {
+		return gut.Err(false, "failed to load checkpoint of state "+*state.Id, err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package function
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// CompactionPin reports whether a tool message is pinned, pinned messages are never compacted
+type CompactionPin func(message *call.AssistantMessage) bool
+
+// Compaction configures summarising older tool messages once the estimated request size passes threshold of the model context window
+type Compaction struct {
+	// Window is the model context window in tokens, a compaction option without it is rejected
+	Window *int `json:"window" validate:"required"`
+	// Threshold is the fraction of Window triggering compaction, defaults to 0.8
+	Threshold *float64 `json:"threshold"`
+	// Keep is the number of most recent tool messages always sent in full, defaults to 4
+	Keep      *int    `json:"keep"`
+	Model     *string `json:"model"`
+	MaxTokens *int    `json:"maxTokens"`
+	Prompt    *string `json:"prompt"`
+	// Caller and Model default to the function calling caller and model
+	Caller call.Caller   `json:"-"`
+	Pin    CompactionPin `json:"-"`
+}
+
+// Summary replaces compacted tool messages of a state, usage aggregates compacted messages and summary calls
+type Summary struct {
+	Content  *string     `json:"content"`
+	Messages int         `json:"messages"`
+	Usage    *call.Usage `json:"usage"`
+}
+
+// Message returns the summary as a user message placed between initial messages and tool messages
+func (r *Summary) Message() *call.UserMessage {
+	return &call.UserMessage{
+		Content: gut.Ptr("Summary of the earlier progress of this task, the original tool calls were compacted:\n" + gut.Val(r.Content)),
+	}
+}
+
+// CompactionTokens counts input tokens of request with the token counter of the function calling caller,
+// falling back to the heuristic tokenizer when counting fails
+func (r *Call) CompactionTokens(request *call.Request) int {
+	tokens, err := call.TokensOf(r.Caller, request, r.Option.CallOption, nil)
+	if err != nil {
+		gut.Debug("compaction token count failed", err)
+		return call.RequestTokens(call.TokenizerHeuristic{}, request, nil)
+	}
+	return tokens
+}
+
+// Compactable returns indexes of tool messages to compact, only the contiguous prefix before the first pinned message
+// and the most recent keep messages is compacted so the summary never covers turns after a pinned message
+func (r *Compaction) Compactable(toolMessages []*call.AssistantMessage) []int {
+	keep := gut.Val(r.Keep, 4)
+	indexes := make([]int, 0)
+	for i := 0; i < len(toolMessages)-keep; i++ {
+		if r.Pin != nil && r.Pin(toolMessages[i]) {
+			break
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// Compact summarises older tool messages of state with the compaction caller when request passes the threshold,
+// whole tool messages are removed so tool calls always stay together with their results
+func (r *Call) Compact(state *State, request *call.Request) *gut.ErrorInstance {
+	compaction := r.Option.Compaction
+	if compaction == nil || compaction.Window == nil {
+		return nil
+	}
+	if float64(r.CompactionTokens(request)) < float64(*compaction.Window)*gut.Val(compaction.Threshold, 0.8) {
+		return nil
+	}
+	indexes := compaction.Compactable(state.ToolMessages)
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	// * render previous summary and compacted tool messages as transcript
+	transcript := new(strings.Builder)
+	if state.Summary != nil {
+		transcript.WriteString("Previous summary: " + gut.Val(state.Summary.Content) + "\n")
+	}
+	for _, i := range indexes {
+		message := state.ToolMessages[i]
+		if message.Content != nil {
+			transcript.WriteString("Assistant: " + *message.Content + "\n")
+		}
+		for _, toolCall := range message.ToolCalls {
+			transcript.WriteString("Tool call: " + toolCall.String() + "\n")
+		}
+	}
+
+	// * summarise with compaction caller
+	caller := compaction.Caller
+	if caller == nil {
+		caller = r.Caller
+	}
+	model := compaction.Model
+	if model == nil {
+		model = r.Option.Model
+	}
+	messages := append(call.Messages{}, state.InitialMessages...)
+	messages = append(messages, &call.UserMessage{
+		Content: gut.Ptr(gut.Val(compaction.Prompt, "Summarise the following tool calls made so far for this task. Keep every fact, identifier, number and decision needed to continue the task, and note what failed. Answer with the summary only.") + "\n\n" + transcript.String()),
+	})
+	response, err := caller.Call(&call.Request{
+		Model:     model,
+		MaxTokens: compaction.MaxTokens,
+		Messages:  messages,
+	}, new(call.Option), nil)
+	if err != nil {
+		return gut.Err(false, "compaction summary call failed", err)
+	}
+	if response.Message == nil || response.Message.Content == nil {
+		return gut.Err(false, "compaction summary call returned no content")
+	}
+	if state.Budget != nil {
+		state.Budget.Spend(response.Message.Usage)
+	}
+
+	// * replace compacted tool messages with summary
+	summary := &Summary{
+		Content:  response.Message.Content,
+		Messages: len(indexes),
+		Usage:    UsageAdd(nil, response.Message.Usage),
+	}
+	if state.Summary != nil {
+		summary.Messages += state.Summary.Messages
+		summary.Usage = UsageAdd(summary.Usage, state.Summary.Usage)
+	}
+	remaining := make([]*call.AssistantMessage, 0, len(state.ToolMessages)-len(indexes))
+	for i, message := range state.ToolMessages {
+		if slices.Contains(indexes, i) {
+			summary.Usage = UsageAdd(summary.Usage, message.Usage)
+			continue
+		}
+		remaining = append(remaining, message)
+	}
+	state.Summary = summary
+	state.ToolMessages = remaining
+
+	return nil
+}
+
+// UsageAdd adds other usage to usage, allocating usage when nil
+func UsageAdd(usage *call.Usage, other *call.Usage) *call.Usage {
+	if usage == nil {
+		usage = &call.Usage{
+			InputTokens:  gut.Ptr[int64](0),
+			OutputTokens: gut.Ptr[int64](0),
+			CachedTokens: gut.Ptr[int64](0),
+		}
+	}
+	if other == nil {
+		return usage
+	}
+	usage.InputTokens = gut.Ptr(gut.Val(usage.InputTokens) + gut.Val(other.InputTokens))
+	usage.OutputTokens = gut.Ptr(gut.Val(usage.OutputTokens) + gut.Val(other.OutputTokens))
+	usage.CachedTokens = gut.Ptr(gut.Val(usage.CachedTokens) + gut.Val(other.CachedTokens))
+	return usage
+}
@@ -0,0 +1,78 @@
+package function
+
+import (
+	"context"
+	"time"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// DeclarationContext carries cancellation, deadline and run metadata of a single tool call to its function,
+// functions should return once the context is done since their result is discarded after the timeout.
+// State is the live state of the run, a function that keeps running after its context is done
+// must stop touching the state as the loop has already moved on
+type DeclarationContext struct {
+	context.Context
+	ToolCall    *call.ToolCall
+	Declaration *Declaration
+	State       *State
+}
+
+// Timeout returns the effective timeout of a declaration, falling back to the option tool timeout
+func (r *Call) Timeout(declaration *Declaration) *time.Duration {
+	if declaration.Timeout != nil {
+		return declaration.Timeout
+	}
+	return r.Option.ToolTimeout
+}
+
+// Invoke runs the declaration function with a context derived from the state context and the declaration timeout,
+// a timed-out call returns immediately with timeout set to true while the function keeps running in background
+func (r *Call) Invoke(state *State, declaration *Declaration, toolCall *call.ToolCall, arguments any) (any, *gut.ErrorInstance, bool) {
+	parent := state.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	if timeout := r.Timeout(declaration); timeout != nil {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, *timeout)
+		defer cancelTimeout()
+	}
+
+	// * adapt map function of declarations without context
+	function := declaration.FuncContext
+	if function == nil {
+		function = func(ctx *DeclarationContext, arguments any) (any, *gut.ErrorInstance) {
+			return declaration.Func(arguments)
+		}
+	}
+
+	// * run function in background to stop waiting when context is done
+	type result struct {
+		response any
+		err      *gut.ErrorInstance
+	}
+	done := make(chan *result, 1)
+	go func() {
+		response, err := function(&DeclarationContext{
+			Context:     ctx,
+			ToolCall:    toolCall,
+			Declaration: declaration,
+			State:       state,
+		}, arguments)
+		done <- &result{response: response, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.response, result.err, false
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			return nil, gut.Err(false, "function call cancelled: "+parent.Err().Error(), parent.Err()), false
+		}
+		return nil, nil, true
+	}
+}
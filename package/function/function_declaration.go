@@ -1,6 +1,8 @@
 package function
 
 import (
+	"time"
+
 	"github.com/bsthun/gut"
 	"go.scnd.dev/open/model/agentic/package/call"
 )
@@ -8,15 +10,39 @@ import (
 // DeclarationFunc defines the function signature for function implementations
 type DeclarationFunc func(arguments any) (map[string]any, *gut.ErrorInstance)
 
+// DeclarationContextFunc defines the function signature for function implementations receiving the tool call context
+// and returning any json serialisable result type
+type DeclarationContextFunc func(ctx *DeclarationContext, arguments any) (any, *gut.ErrorInstance)
+
 // Declaration represents a function declaration with metadata and implementation
 type Declaration struct {
-	Name            *string         `json:"name"`
-	Description     *string         `json:"description"`
-	Source          *string         `json:"source"`
-	Terminator      *bool           `json:"terminator"` // TODO: Add terminator support
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Source      *string `json:"source"`
+	// Terminator ends the function calling loop with the arguments of a successful call as the output
+	Terminator *bool `json:"terminator"`
+	// Serial never runs the declaration concurrently with other tool calls of the same turn
+	Serial *bool `json:"serial"`
+	// Approval suspends the loop until the tool call is approved or rejected
+	Approval *bool `json:"approval"`
+	// Strict unmarshals arguments as is without repair and type coercion
+	Strict *bool `json:"strict"`
+	// Cache answers repeated calls from the state cache or option cache store until CacheTtl elapses
+	Cache    *bool               `json:"cache"`
+	CacheTtl *time.Duration      `json:"cacheTtl"`
+	CacheKey DeclarationCacheKey `json:"-"`
+	// Retry retries transient failures of the function before they are reported to the model
+	Retry *RetryPolicy `json:"retry"`
+	// Timeout bounds a single call and overrides the option tool timeout
+	Timeout *time.Duration `json:"timeout"`
+	// ResultLimit and ResultOverflow override the option tool result limit and overflow handling
+	ResultLimit     *int            `json:"resultLimit"`
+	ResultOverflow  *ResultOverflow `json:"resultOverflow"`
 	Arguments       any             `json:"arguments"`
 	ArgumentsSchema *call.Schema    `json:"-"`
 	Func            DeclarationFunc `json:"-"`
+	// FuncContext takes precedence over Func when both are set
+	FuncContext DeclarationContextFunc `json:"-"`
 }
 
 func NewDeclaration[T any](
@@ -44,3 +70,30 @@ func NewDeclaration[T any](
 		},
 	}
 }
+
+// NewDeclarationContext creates a declaration whose function receives the tool call context,
+// which is cancelled when the declaration timeout elapses or the state context is cancelled
+func NewDeclarationContext[T any](
+	name *string,
+	description *string,
+	function func(ctx *DeclarationContext, arguments *T) (map[string]any, *gut.ErrorInstance),
+) *Declaration {
+	return NewDeclarationResult(name, description, function)
+}
+
+// NewTerminator creates a terminator declaration that accepts the final answer as its arguments,
+// the function calling loop ends once it is called with valid arguments and they are unmarshalled into the output,
+// a plain answer is re-prompted once with the terminator as required tool choice before the loop fails
+func NewTerminator[T any](
+	name *string,
+	description *string,
+) *Declaration {
+	declaration := NewDeclaration(name, description, func(arguments *T) (map[string]any, *gut.ErrorInstance) {
+		return map[string]any{
+			"accepted": true,
+		}, nil
+	})
+	declaration.Terminator = gut.Ptr(true)
+
+	return declaration
+}
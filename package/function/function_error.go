@@ -0,0 +1,144 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+type ToolErrorKind string
+
+const (
+	ToolErrorKindUnknownTool      ToolErrorKind = "unknown_tool"
+	ToolErrorKindInvalidArguments ToolErrorKind = "invalid_arguments"
+	ToolErrorKindExecutionFailed  ToolErrorKind = "execution_failed"
+	ToolErrorKindTimeout          ToolErrorKind = "timeout"
+	ToolErrorKindRejected         ToolErrorKind = "rejected"
+)
+
+// ToolError is the structured error envelope reported to the model as the tool call error,
+// tools lists the closest matching tool names and schema holds the arguments schema of the called tool
+type ToolError struct {
+	Kind      ToolErrorKind `json:"kind"`
+	Tool      *string       `json:"tool,omitempty"`
+	Message   string        `json:"message"`
+	Retryable bool          `json:"retryable"`
+	Hints     []string      `json:"hints,omitempty"`
+	Tools     []string      `json:"tools,omitempty"`
+	Schema    *call.Schema  `json:"schema,omitempty"`
+}
+
+func (r *ToolError) Error() string {
+	return string(r.Kind) + ": " + r.Message
+}
+
+// Err wraps the tool error into an error instance, tool functions return it to give the model recovery guidance
+func (r *ToolError) Err() *gut.ErrorInstance {
+	return gut.Err(false, r.Message, r)
+}
+
+// Render renders the envelope as json for the tool call error
+func (r *ToolError) Render() *string {
+	content, err := json.Marshal(r)
+	if err != nil {
+		return gut.Ptr(r.Error())
+	}
+	return gut.Ptr(string(content))
+}
+
+// NewToolError creates a tool error for a tool function to return with recovery hints
+func NewToolError(kind ToolErrorKind, message string, retryable bool, hints ...string) *gut.ErrorInstance {
+	return (&ToolError{
+		Kind:      kind,
+		Message:   message,
+		Retryable: retryable,
+		Hints:     hints,
+	}).Err()
+}
+
+// ToolErrorOf returns the tool error carried by err, or nil if err does not carry one
+func ToolErrorOf(err *gut.ErrorInstance) *ToolError {
+	if err == nil {
+		return nil
+	}
+	for _, block := range err.Errors {
+		var toolError *ToolError
+		if block.Err != nil && errors.As(block.Err, &toolError) {
+			return toolError
+		}
+	}
+	return nil
+}
+
+// ToolErrorParse parses a tool call error rendered as envelope, returning nil for free text errors
+func ToolErrorParse(content *string) *ToolError {
+	if content == nil {
+		return nil
+	}
+	toolError := new(ToolError)
+	if err := json.Unmarshal([]byte(*content), toolError); err != nil || toolError.Kind == "" {
+		return nil
+	}
+	return toolError
+}
+
+// ToolClosest returns up to limit declaration names closest to name by edit distance, an empty name has no suggestions
+func ToolClosest(declarations []*Declaration, name string, limit int) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	names := make([]string, 0)
+	if name == "" {
+		return names
+	}
+	candidates := make([]*candidate, 0)
+	lowerName := strings.ToLower(name)
+	for _, declaration := range declarations {
+		declarationName := gut.Val(declaration.Name)
+		if declarationName == "" {
+			continue
+		}
+		lowerDeclarationName := strings.ToLower(declarationName)
+		distance := ToolDistance(lowerName, lowerDeclarationName)
+		if distance <= max(len(declarationName), len(name))/2 || strings.Contains(lowerDeclarationName, lowerName) || strings.Contains(lowerName, lowerDeclarationName) {
+			candidates = append(candidates, &candidate{name: declarationName, distance: distance})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	for _, candidate := range candidates {
+		if len(names) >= limit {
+			break
+		}
+		names = append(names, candidate.name)
+	}
+	return names
+}
+
+// ToolDistance returns the levenshtein distance between a and b
+func ToolDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,136 @@
+package function
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+type ResultOverflow string
+
+const (
+	ResultOverflowTruncate ResultOverflow = "truncate"
+	ResultOverflowSummary  ResultOverflow = "summary"
+	ResultOverflowArtifact ResultOverflow = "artifact"
+)
+
+// ResultLimit returns the effective result size limit in bytes and overflow handling of a declaration,
+// declaration settings override option settings and overflow defaults to truncation
+func (r *Call) ResultLimit(declaration *Declaration) (*int, ResultOverflow) {
+	limit := r.Option.ToolResultLimit
+	if declaration.ResultLimit != nil {
+		limit = declaration.ResultLimit
+	}
+	overflow := gut.Val(r.Option.ToolResultOverflow, ResultOverflowTruncate)
+	if declaration.ResultOverflow != nil {
+		overflow = *declaration.ResultOverflow
+	}
+	if overflow == ResultOverflowArtifact && r.Option.ArtifactStore == nil {
+		overflow = ResultOverflowTruncate
+	}
+	return limit, overflow
+}
+
+// ArtifactLength returns the page length of the built-in read_artifact tool, the largest result limit of declarations
+// overflowing to an artifact, or zero when no declaration can overflow to an artifact
+func (r *Call) ArtifactLength() int {
+	length := 0
+	for _, declaration := range r.Declarations {
+		if limit, overflow := r.ResultLimit(declaration); limit != nil && overflow == ResultOverflowArtifact {
+			length = max(length, *limit)
+		}
+	}
+	return length
+}
+
+// Limit bounds a marshalled tool result to the declaration result limit,
+// an oversized result is replaced by a truncated, summarised or artifact envelope according to overflow handling
+func (r *Call) Limit(state *State, declaration *Declaration, toolCall *call.ToolCall, result []byte) []byte {
+	limit, overflow := r.ResultLimit(declaration)
+	if limit == nil || len(result) <= *limit {
+		return result
+	}
+
+	envelope := map[string]any{
+		"size": len(result),
+	}
+	switch overflow {
+	case ResultOverflowArtifact:
+		id, err := r.Option.ArtifactStore.Put(toolCall.Name, result)
+		if err != nil {
+			gut.Debug("tool result artifact store failed, truncating instead", err)
+			break
+		}
+		envelope["artifact"] = *id
+		envelope["preview"] = LimitPreview(result, *limit/2)
+		envelope["message"] = "The result is too large and was stored as an artifact, use read_artifact with this id and an offset to page through it"
+	case ResultOverflowSummary:
+		summary, err := r.LimitSummary(state, toolCall, result, *limit)
+		if err != nil {
+			gut.Debug("tool result summary failed, truncating instead", err)
+			break
+		}
+		envelope["summary"] = *summary
+		envelope["message"] = "The result is too large and was summarised"
+	default:
+	}
+
+	// * truncate when not handled by overflow handling
+	if envelope["message"] == nil {
+		envelope["truncated"] = LimitPreview(result, *limit)
+		envelope["message"] = "The result is too large and was truncated to " + strconv.Itoa(*limit) + " bytes"
+	}
+
+	content, err := json.Marshal(envelope)
+	if err != nil {
+		return []byte(LimitPreview(result, *limit))
+	}
+	return content
+}
+
+// LimitSummary asks the model to summarise an oversized tool result within limit bytes in a secondary call without tools,
+// usage of the call is spent from the state budget
+func (r *Call) LimitSummary(state *State, toolCall *call.ToolCall, result []byte, limit int) (*string, *gut.ErrorInstance) {
+	request := &call.Request{
+		Model:           r.Option.Model,
+		MaxTokens:       r.Option.MaxTokens,
+		Temperature:     r.Option.Temperature,
+		TopP:            r.Option.TopP,
+		TopK:            r.Option.TopK,
+		ReasoningEffort: r.Option.ReasoningEffort,
+		Messages: []call.Message{
+			&call.UserMessage{
+				Content: gut.Ptr("Summarise the following tool result in at most " + strconv.Itoa(limit) + " bytes. Keep identifiers, numbers and facts needed to continue the task.\n\n" +
+					"Tool " + gut.Val(toolCall.Name) + " called with " + string(toolCall.Arguments) + " returned:\n" + string(result)),
+			},
+		},
+	}
+	response, err := r.Caller.Call(request, r.Option.CallOption, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.Message == nil || response.Message.Content == nil {
+		return nil, gut.Err(false, "empty tool result summary")
+	}
+	if state.Budget != nil {
+		state.mutex.Lock()
+		state.Budget.Spend(response.Message.Usage)
+		state.mutex.Unlock()
+	}
+	summary := LimitPreview([]byte(*response.Message.Content), limit)
+	return &summary, nil
+}
+
+// LimitPreview cuts content to at most limit bytes without splitting utf-8 characters
+func LimitPreview(content []byte, limit int) string {
+	if limit < 0 {
+		limit = 0
+	}
+	if len(content) > limit {
+		content = content[:limit]
+	}
+	return strings.ToValidUTF8(string(content), "")
+}
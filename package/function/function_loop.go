@@ -0,0 +1,169 @@
+package function
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+type LoopKind string
+
+const (
+	LoopKindRepeat LoopKind = "repeat"
+	LoopKindStall  LoopKind = "stall"
+	LoopKindErrors LoopKind = "errors"
+)
+
+type LoopAction string
+
+const (
+	LoopActionNudge      LoopAction = "nudge"
+	LoopActionToolChoice LoopAction = "toolChoice"
+	LoopActionAbort      LoopAction = "abort"
+)
+
+// LoopErrorCode is the error code of function calling loop errors caused by an aborted loop detection
+const LoopErrorCode = "loop_detected"
+
+// LoopDetection configures detection of unproductive function calling loops, a nil threshold disables its detection
+type LoopDetection struct {
+	// Repeat detects a turn with the same tool calls occurring repeat times within the last Window turns, including oscillation
+	Repeat *int `json:"repeat"`
+	// Window defaults to 6 turns and is widened to Repeat when smaller so repeats can still be detected
+	Window *int `json:"window"`
+	// Stall detects consecutive turns without a new successful result
+	Stall *int `json:"stall"`
+	// Errors detects consecutive turns failing entirely
+	Errors     *int             `json:"errors"`
+	Action     *LoopAction      `json:"action"`
+	Nudge      *string          `json:"nudge"`
+	ToolChoice *call.ToolChoice `json:"toolChoice"`
+}
+
+// LoopError reports a detected unproductive loop with a diagnostic detail
+type LoopError struct {
+	Kind   LoopKind `json:"kind"`
+	Detail string   `json:"detail"`
+}
+
+func (r *LoopError) Error() string {
+	return "function calling loop detected: " + string(r.Kind) + ", " + r.Detail
+}
+
+// LoopErrorOf returns the loop error carried by err, or nil if err is not caused by an aborted loop detection
+func LoopErrorOf(err *gut.ErrorInstance) *LoopError {
+	if err == nil {
+		return nil
+	}
+	for _, block := range err.Errors {
+		var loopError *LoopError
+		if block.Err != nil && errors.As(block.Err, &loopError) {
+			return loopError
+		}
+	}
+	return nil
+}
+
+// Loop tracks tool calls of a single function calling loop for loop detection
+type Loop struct {
+	Signatures []string        `json:"signatures"`
+	Results    map[string]bool `json:"results"`
+	Stall      int             `json:"stall"`
+	Errors     int             `json:"errors"`
+}
+
+func NewLoop() *Loop {
+	return &Loop{
+		Signatures: make([]string, 0),
+		Results:    make(map[string]bool),
+	}
+}
+
+// Observe records executed tool calls of a turn and returns the detected loop, or nil when the loop progresses,
+// the counter of a detected loop is reset so the configured action applies once per detection
+func (r *Loop) Observe(detection *LoopDetection, toolCalls []*call.ToolCall) *LoopError {
+	if detection == nil || len(toolCalls) == 0 {
+		return nil
+	}
+
+	// * record turn signature within window
+	signatures := make([]string, 0, len(toolCalls))
+	progress := false
+	failed := true
+	for _, toolCall := range toolCalls {
+		signatures = append(signatures, gut.Val(toolCall.Name)+string(toolCall.Arguments))
+		if toolCall.Error == nil {
+			failed = false
+			if !r.Results[string(toolCall.Result)] {
+				r.Results[string(toolCall.Result)] = true
+				progress = true
+			}
+		}
+	}
+	slices.Sort(signatures)
+	signature := strings.Join(signatures, "\n")
+	r.Signatures = append(r.Signatures, signature)
+	if window := max(gut.Val(detection.Window, 6), gut.Val(detection.Repeat, 0)); len(r.Signatures) > window {
+		r.Signatures = r.Signatures[len(r.Signatures)-window:]
+	}
+
+	// * count turns without progress and failing turns
+	r.Stall++
+	if progress {
+		r.Stall = 0
+	}
+	r.Errors++
+	if !failed {
+		r.Errors = 0
+	}
+
+	if detection.Repeat != nil {
+		count := 0
+		for _, previous := range r.Signatures {
+			if previous == signature {
+				count++
+			}
+		}
+		if count >= *detection.Repeat {
+			r.Signatures = make([]string, 0)
+			return &LoopError{
+				Kind:   LoopKindRepeat,
+				Detail: "identical tool calls repeated " + strconv.Itoa(count) + " times: " + strings.ReplaceAll(signature, "\n", ", "),
+			}
+		}
+	}
+	if detection.Errors != nil && r.Errors >= *detection.Errors {
+		count := r.Errors
+		r.Errors = 0
+		return &LoopError{
+			Kind:   LoopKindErrors,
+			Detail: "all tool calls failed in " + strconv.Itoa(count) + " consecutive turns",
+		}
+	}
+	if detection.Stall != nil && r.Stall >= *detection.Stall {
+		count := r.Stall
+		r.Stall = 0
+		return &LoopError{
+			Kind:   LoopKindStall,
+			Detail: "no new tool result in " + strconv.Itoa(count) + " consecutive turns",
+		}
+	}
+
+	return nil
+}
+
+// LoopNudge returns the corrective user message injected into the next turn after a loop detection,
+// a user message keeps the nudge in place with callers such as anthropic that move system messages out of the conversation
+func LoopNudge(detection *LoopDetection, loopError *LoopError) *call.UserMessage {
+	content := "You appear to be stuck (" + loopError.Detail + "). Do not repeat the same calls. Reconsider the approach, use different tools or arguments, or give your best final answer now."
+	if detection.Nudge != nil {
+		content = *detection.Nudge
+	}
+	return &call.UserMessage{
+		Content: &content,
+	}
+}
@@ -1,8 +1,12 @@
 package function
 
-import "go.scnd.dev/open/model/agentic/package/call"
+import (
+	"time"
 
-// Option contains configuration for function calling, extended call options.
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// Option contains configuration for function calling, extended call options
 type Option struct {
 	Model             *string               `json:"model"`
 	MaxTokens         *int                  `json:"maxTokens"`
@@ -12,5 +16,34 @@ type Option struct {
 	ReasoningEffort   *call.ReasoningEffort `json:"reasoningEffort"`
 	ParseErrorBreak   *bool                 `json:"parseErrorBreak"`
 	ParseErrorCompact *bool                 `json:"parseErrorTruncate"`
-	CallOption        *call.Option          `json:"callOption"`
+	// MaxTurns, MaxTotalTokens, MaxToolCalls and MaxDuration bound the loop of a state across resumes and end it with a BudgetError
+	MaxTurns       *int           `json:"maxTurns"`
+	MaxTotalTokens *int64         `json:"maxTotalTokens"`
+	MaxToolCalls   *int           `json:"maxToolCalls"`
+	MaxDuration    *time.Duration `json:"maxDuration"`
+	// BudgetSummary makes one final call without tools to summarise the progress when a budget limit is reached
+	BudgetSummary *bool `json:"budgetSummary"`
+	// ToolConcurrency limits tool calls of a model turn running at once, nil runs them one by one
+	ToolConcurrency *int `json:"toolConcurrency"`
+	// ToolTimeout bounds each tool call of declarations without their own timeout, nil waits indefinitely
+	ToolTimeout *time.Duration   `json:"toolTimeout"`
+	ToolChoice  *call.ToolChoice `json:"toolChoice"`
+	// ToolResultLimit bounds the marshalled size in bytes of each tool result, handled by ToolResultOverflow when exceeded
+	ToolResultLimit    *int            `json:"toolResultLimit"`
+	ToolResultOverflow *ResultOverflow `json:"toolResultOverflow"`
+	// ArtifactStore keeps results of artifact overflow and exposes the built-in read_artifact tool
+	ArtifactStore ArtifactStore `json:"-"`
+	// ToolSelector chooses declarations exposed on each turn
+	ToolSelector ToolSelector `json:"-"`
+	// ToolSearch exposes the built-in search_tools tool
+	ToolSearch *bool `json:"toolSearch"`
+	// CacheStore shares results of cacheable declarations across runs in addition to the state cache
+	CacheStore CacheStore `json:"-"`
+	// LoopDetection detects repeated calls, stalls and repeated errors
+	LoopDetection *LoopDetection `json:"loopDetection"`
+	// StateStore checkpoints states with an id, restores fresh states and deletes the checkpoint once the run completes
+	StateStore StateStore `json:"-"`
+	// Compaction summarises older tool messages once the request nears the model context window
+	Compaction *Compaction  `json:"compaction"`
+	CallOption *call.Option `json:"callOption"`
 }
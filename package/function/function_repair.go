@@ -0,0 +1,50 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// ArgumentsRepair leniently decodes tool call arguments of a non-strict declaration,
+// it repairs malformed json and coerces values to the declaration arguments schema,
+// returning the arguments to unmarshal and descriptions of applied repairs
+func (r *Call) ArgumentsRepair(declaration *Declaration, arguments []byte) ([]byte, []string) {
+	repairs := make([]string, 0)
+	if declaration.Strict != nil && *declaration.Strict {
+		return arguments, repairs
+	}
+
+	// * decode arguments, repairing malformed json
+	var value any
+	if !call.SchemaCoerceDecode(string(arguments), &value) {
+		for _, candidate := range call.ContentExtract(string(arguments), "") {
+			if call.SchemaCoerceDecode(candidate, &value) {
+				repairs = append(repairs, "$: repaired malformed json")
+				break
+			}
+		}
+		if len(repairs) == 0 {
+			return arguments, repairs
+		}
+	}
+
+	// * coerce decoded value to arguments schema
+	value, coerceRepairs := call.SchemaCoerce(declaration.ArgumentsSchema, value, "")
+	repairs = append(repairs, coerceRepairs...)
+	if len(repairs) == 0 {
+		return arguments, repairs
+	}
+
+	repaired, err := json.Marshal(value)
+	if err != nil {
+		return arguments, make([]string, 0)
+	}
+	for _, repair := range repairs {
+		gut.Debug("tool arguments repair", gut.Val(declaration.Name), repair)
+	}
+
+	return bytes.TrimSpace(repaired), repairs
+}
@@ -0,0 +1,49 @@
+package function
+
+import (
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// Result is a tool function result carrying multimodal content parts alongside its json value,
+// parts are forwarded to the model as tool result content such as images or documents
+type Result struct {
+	Value any                 `json:"value"`
+	Parts []*call.ContentPart `json:"parts"`
+}
+
+// NewResult creates a result with a json value and content parts
+func NewResult(value any, parts ...*call.ContentPart) *Result {
+	return &Result{
+		Value: value,
+		Parts: parts,
+	}
+}
+
+// NewDeclarationResult creates a declaration whose function returns any json serialisable result type,
+// returning *Result attaches content parts to the tool result
+func NewDeclarationResult[T any, R any](
+	name *string,
+	description *string,
+	function func(ctx *DeclarationContext, arguments *T) (R, *gut.ErrorInstance),
+) *Declaration {
+	return &Declaration{
+		Name:            name,
+		Description:     description,
+		Source:          nil,
+		Arguments:       new(T),
+		ArgumentsSchema: call.SchemaConvert(new(T)),
+		FuncContext: func(ctx *DeclarationContext, arguments any) (any, *gut.ErrorInstance) {
+			if arguments == nil {
+				return function(ctx, new(T))
+			}
+
+			parsed, ok := arguments.(*T)
+			if !ok {
+				return nil, gut.Err(false, "invalid argument type")
+			}
+
+			return function(ctx, parsed)
+		},
+	}
+}
@@ -0,0 +1,106 @@
+package function
+
+import (
+	"math"
+	"time"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// RetryPolicy retries transient tool function failures locally before reporting them to the model
+type RetryPolicy struct {
+	// Attempts counts the first call
+	Attempts *int `json:"attempts"`
+	// Backoff starts at RetryBackoff by default and grows by Multiplier, doubling by default, after each failure up to BackoffMax
+	Backoff    *time.Duration `json:"backoff"`
+	BackoffMax *time.Duration `json:"backoffMax"`
+	Multiplier *float64       `json:"multiplier"`
+	// Retryable decides whether an error is transient and defaults to errors not marked as non-retryable tool errors
+	Retryable func(err *gut.ErrorInstance) bool `json:"-"`
+}
+
+// RetryBackoff is the default backoff before the first retry of a retry policy without backoff
+const RetryBackoff = 100 * time.Millisecond
+
+// Delay returns the backoff before the attempt following the given failed attempt, counted from one
+func (r *RetryPolicy) Delay(attempt int) time.Duration {
+	delay := time.Duration(float64(gut.Val(r.Backoff, RetryBackoff)) * math.Pow(gut.Val(r.Multiplier, 2), float64(attempt-1)))
+	if r.BackoffMax != nil && delay > *r.BackoffMax {
+		delay = *r.BackoffMax
+	}
+	return delay
+}
+
+// Transient reports whether err should be retried under the policy
+func (r *RetryPolicy) Transient(err *gut.ErrorInstance) bool {
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+	if toolError := ToolErrorOf(err); toolError != nil {
+		return toolError.Retryable
+	}
+	return true
+}
+
+// InvokeRetry invokes the declaration function under its retry policy,
+// every failed attempt that is retried is reported to the after callback with its attempt number,
+// an error returned by the callback stops retrying and is returned separately to end the function calling loop
+func (r *Call) InvokeRetry(state *State, declaration *Declaration, toolCall *call.ToolCall, arguments any, callback *CallbackBeforeFunctionCall) (any, *gut.ErrorInstance, bool, *gut.ErrorInstance) {
+	policy := declaration.Retry
+	attempts := 1
+	if policy != nil && policy.Attempts != nil && *policy.Attempts > 1 {
+		attempts = *policy.Attempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempts > 1 {
+			callback.Attempt = gut.Ptr(attempt)
+		}
+		response, funcErr, timedOut := r.Invoke(state, declaration, toolCall, arguments)
+		if funcErr == nil && !timedOut {
+			return response, nil, false, nil
+		}
+
+		// * stop when attempts are exhausted, the run is cancelled or the failure is not transient
+		if attempt >= attempts || (state.Context != nil && state.Context.Err() != nil) {
+			return response, funcErr, timedOut, nil
+		}
+		failure := funcErr
+		if timedOut {
+			failure = NewToolError(ToolErrorKindTimeout, "function call timed out", true)
+		}
+		if !policy.Transient(failure) {
+			return response, funcErr, timedOut, nil
+		}
+
+		// * report failed attempt
+		if state.OnAfterFunctionCall != nil {
+			state.mutex.Lock()
+			_, err := state.OnAfterFunctionCall(&CallbackAfterFunctionCall{
+				CallbackBeforeFunctionCall: *callback,
+				Result:                     nil,
+				Error:                      gut.Ptr(failure.Error()),
+			})
+			state.mutex.Unlock()
+			if err != nil {
+				return nil, nil, false, err
+			}
+		}
+		gut.Debug("tool call retry", gut.Val(toolCall.Name), attempt, failure)
+
+		// * wait for backoff unless the run is cancelled
+		if delay := policy.Delay(attempt); delay > 0 {
+			timer := time.NewTimer(delay)
+			if state.Context != nil {
+				select {
+				case <-timer.C:
+				case <-state.Context.Done():
+					timer.Stop()
+				}
+			} else {
+				<-timer.C
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package function
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+// ToolSelection describes a model turn for which a tool selector chooses declarations to expose
+type ToolSelection struct {
+	Turn         int            `json:"turn"`
+	Messages     []call.Message `json:"-"`
+	Declarations []*Declaration `json:"declarations"`
+}
+
+// ToolSelector chooses which declarations are exposed to the model on a turn,
+// terminators, built-in declarations and tools discovered through tool search are always exposed in addition
+type ToolSelector interface {
+	Select(selection *ToolSelection) []*Declaration
+}
+
+// ToolSelectorFunc adapts a function to ToolSelector
+type ToolSelectorFunc func(selection *ToolSelection) []*Declaration
+
+func (r ToolSelectorFunc) Select(selection *ToolSelection) []*Declaration {
+	return r(selection)
+}
+
+// ToolSelectorAllow exposes declarations whose name is in the allowlist
+type ToolSelectorAllow struct {
+	Names []string `json:"names"`
+}
+
+func (r *ToolSelectorAllow) Select(selection *ToolSelection) []*Declaration {
+	declarations := make([]*Declaration, 0)
+	for _, declaration := range selection.Declarations {
+		if slices.Contains(r.Names, gut.Val(declaration.Name)) {
+			declarations = append(declarations, declaration)
+		}
+	}
+	return declarations
+}
+
+// ToolSelectorSource exposes declarations from the listed sources, declarations without source match an empty source
+type ToolSelectorSource struct {
+	Sources []string `json:"sources"`
+}
+
+func (r *ToolSelectorSource) Select(selection *ToolSelection) []*Declaration {
+	declarations := make([]*Declaration, 0)
+	for _, declaration := range selection.Declarations {
+		if slices.Contains(r.Sources, gut.Val(declaration.Source)) {
+			declarations = append(declarations, declaration)
+		}
+	}
+	return declarations
+}
+
+// ToolSelectorKeyword exposes up to limit declarations ranked by keyword overlap with the recent conversation,
+// all declarations are exposed when none overlaps so the model is never left without tools
+type ToolSelectorKeyword struct {
+	Limit int `json:"limit"`
+}
+
+func (r *ToolSelectorKeyword) Select(selection *ToolSelection) []*Declaration {
+	return ToolRankFallback(selection.Declarations, SelectionText(selection.Messages), r.Limit)
+}
+
+// ToolSelectorEmbedding exposes up to limit declarations ranked by embedding similarity with the recent conversation,
+// declaration embeddings are computed once and reused across turns and concurrent runs
+type ToolSelectorEmbedding struct {
+	Embed      func(texts []string) ([][]float64, *gut.ErrorInstance) `json:"-"`
+	Limit      int                                                    `json:"limit"`
+	embeddings map[*Declaration][]float64
+	mutex      sync.Mutex
+}
+
+func (r *ToolSelectorEmbedding) Select(selection *ToolSelection) []*Declaration {
+	// * embed declarations not embedded yet
+	r.mutex.Lock()
+	if r.embeddings == nil {
+		r.embeddings = make(map[*Declaration][]float64)
+	}
+	pending := make([]*Declaration, 0)
+	texts := make([]string, 0)
+	for _, declaration := range selection.Declarations {
+		if _, ok := r.embeddings[declaration]; !ok {
+			pending = append(pending, declaration)
+			texts = append(texts, DeclarationText(declaration))
+		}
+	}
+	r.mutex.Unlock()
+	text := SelectionText(selection.Messages)
+	vectors, err := r.Embed(append(texts, text))
+	if err != nil || len(vectors) != len(texts)+1 {
+		gut.Debug("tool selector embedding failed, falling back to keyword ranking", err)
+		return ToolRankFallback(selection.Declarations, text, r.Limit)
+	}
+
+	// * rank declarations by cosine similarity
+	query := vectors[len(vectors)-1]
+	declarations := slices.Clone(selection.Declarations)
+	scores := make(map[*Declaration]float64)
+	r.mutex.Lock()
+	for i, declaration := range pending {
+		r.embeddings[declaration] = vectors[i]
+	}
+	for _, declaration := range declarations {
+		scores[declaration] = ToolCosine(query, r.embeddings[declaration])
+	}
+	r.mutex.Unlock()
+	sort.SliceStable(declarations, func(i, j int) bool {
+		return scores[declarations[i]] > scores[declarations[j]]
+	})
+	if r.Limit > 0 && len(declarations) > r.Limit {
+		declarations = declarations[:r.Limit]
+	}
+	return declarations
+}
+
+// ToolRank ranks declarations by keyword overlap with text and returns up to limit declarations with a positive score
+func ToolRank(declarations []*Declaration, text string, limit int) []*Declaration {
+	keywords := ToolKeywords(text)
+	ranked := make([]*Declaration, 0)
+	scores := make(map[*Declaration]int)
+	for _, declaration := range declarations {
+		score := 0
+		for _, keyword := range ToolKeywords(DeclarationText(declaration)) {
+			if slices.Contains(keywords, keyword) {
+				score++
+			}
+		}
+		if score > 0 {
+			scores[declaration] = score
+			ranked = append(ranked, declaration)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// ToolRankFallback ranks declarations like ToolRank, returning all declarations when none overlaps with text
+func ToolRankFallback(declarations []*Declaration, text string, limit int) []*Declaration {
+	ranked := ToolRank(declarations, text, limit)
+	if len(ranked) == 0 {
+		return declarations
+	}
+	return ranked
+}
+
+// ToolKeywords splits text into distinct lowercase keywords of at least three characters
+func ToolKeywords(text string) []string {
+	keywords := make([]string, 0)
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) {
+		if len(field) >= 3 && !slices.Contains(keywords, field) {
+			keywords = append(keywords, field)
+		}
+	}
+	return keywords
+}
+
+// ToolCosine returns cosine similarity of two vectors, or zero when they cannot be compared
+func ToolCosine(a []float64, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// DeclarationText renders name and description of a declaration for relevance ranking
+func DeclarationText(declaration *Declaration) string {
+	return gut.Val(declaration.Name) + " " + gut.Val(declaration.Description)
+}
+
+// SelectionText renders the recent conversation for relevance ranking,
+// starting from the latest user message followed by later assistant content and tool call names
+func SelectionText(messages []call.Message) string {
+	start := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		if _, ok := messages[i].(*call.UserMessage); ok {
+			start = i
+			break
+		}
+	}
+
+	builder := new(strings.Builder)
+	for _, message := range messages[start:] {
+		switch m := message.(type) {
+		case *call.UserMessage:
+			builder.WriteString(gut.Val(m.Content) + "\n")
+		case *call.AssistantMessage:
+			builder.WriteString(gut.Val(m.Content) + "\n")
+			for _, toolCall := range m.ToolCalls {
+				builder.WriteString(gut.Val(toolCall.Name) + "\n")
+			}
+		}
+	}
+	return builder.String()
+}
+
+// ToolSearchArguments searches the tool catalogue by keywords
+type ToolSearchArguments struct {
+	Query *string `json:"query" validate:"required" description:"Keywords describing the capability needed"`
+	Limit *int    `json:"limit" description:"Maximum number of tools to return, defaults to 5"`
+}
+
+// NewToolSearch creates the built-in search_tools declaration searching declarations returned by catalogue,
+// found tools are recorded in the state and exposed on following turns
+func NewToolSearch(catalogue func() []*Declaration) *Declaration {
+	return NewDeclarationResult(
+		gut.Ptr("search_tools"),
+		gut.Ptr("Search the tool catalogue for tools not currently available, found tools become available on the next turn"),
+		func(ctx *DeclarationContext, arguments *ToolSearchArguments) (map[string]any, *gut.ErrorInstance) {
+			found := ToolRank(catalogue(), *arguments.Query, gut.Val(arguments.Limit, 5))
+
+			tools := make([]map[string]any, 0)
+			ctx.State.mutex.Lock()
+			for _, declaration := range found {
+				if !slices.Contains(ctx.State.Discovered, gut.Val(declaration.Name)) {
+					ctx.State.Discovered = append(ctx.State.Discovered, gut.Val(declaration.Name))
+				}
+				tools = append(tools, map[string]any{
+					"name":        gut.Val(declaration.Name),
+					"description": gut.Val(declaration.Description),
+				})
+			}
+			ctx.State.mutex.Unlock()
+
+			return map[string]any{
+				"tools": tools,
+			}, nil
+		},
+	)
+}
+
+// Select returns tools exposed to the model on a turn according to the option tool selector
+func (r *Call) Select(state *State, turn int) []*call.Tool {
+	if r.Option.ToolSelector == nil {
+		return r.Tools()
+	}
+
+	// * let selector choose among registered declarations
+	selected := r.Option.ToolSelector.Select(&ToolSelection{
+		Turn:         turn,
+		Messages:     state.Messages(),
+		Declarations: r.Declarations,
+	})
+
+	// * keep terminators, built-in and discovered declarations exposed
+	declarations := make([]*Declaration, 0)
+	for _, declaration := range r.Available() {
+		exposed := slices.Contains(selected, declaration) ||
+			gut.Val(declaration.Terminator) ||
+			!slices.Contains(r.Declarations, declaration) ||
+			slices.Contains(state.Discovered, gut.Val(declaration.Name))
+		if exposed {
+			declarations = append(declarations, declaration)
+		}
+	}
+
+	return DeclarationTools(declarations)
+}
@@ -1,6 +1,11 @@
 package function
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
 	"github.com/bsthun/gut"
 	"go.scnd.dev/open/model/agentic/package/call"
 )
@@ -11,13 +16,57 @@ type StateOnAfterFunctionCall func(callback *CallbackAfterFunctionCall) (map[str
 
 type StateOnToolMessage func(message *call.AssistantMessage) *gut.ErrorInstance
 
+// StateOnTurnStart is invoked before each model turn of state, counted from zero, an error ends the loop
+type StateOnTurnStart func(state *State, turn int) *gut.ErrorInstance
+
+// StateOnRequest is invoked with the request of a model turn of state before it is sent,
+// the request is built for the turn so changes only apply to that turn
+type StateOnRequest func(state *State, turn int, request *call.Request) *gut.ErrorInstance
+
+// StateOnResponse is invoked with the response of a model turn of state before its finish reason is handled,
+// the finish reason may be changed, such as treating a length finish as stop
+type StateOnResponse func(state *State, turn int, response *call.Response) *gut.ErrorInstance
+
+// StateOnEnd is invoked with the final response of the loop of state, whose total usage aggregates the whole run
+type StateOnEnd func(state *State, response *call.Response)
+
+// StateOnError is invoked with the error ending the loop of state
+type StateOnError func(state *State, err *gut.ErrorInstance)
+
+// StateOnToolChoice returns the tool choice for a model turn, counted from zero, or nil to use the option tool choice
+type StateOnToolChoice func(turn int) *call.ToolChoice
+
 // State uses for manages conversation messages and callback hooks using function calling
 type State struct {
-	InitialMessages      []call.Message            `json:"initialMessages"`
-	ToolMessages         []*call.AssistantMessage  `json:"toolMessages"`
+	// Id identifies the run when checkpointing to a state store
+	Id              *string                  `json:"id"`
+	InitialMessages call.Messages            `json:"initialMessages"`
+	ToolMessages    []*call.AssistantMessage `json:"toolMessages"`
+	// OnBeforeFunctionCall and the other hooks are never invoked concurrently, including from subagent states inheriting this state
 	OnBeforeFunctionCall StateOnBeforeFunctionCall `json:"-"`
 	OnAfterFunctionCall  StateOnAfterFunctionCall  `json:"-"`
 	OnToolMessage        StateOnToolMessage        `json:"-"`
+	OnToolChoice         StateOnToolChoice         `json:"-"`
+	OnTurnStart          StateOnTurnStart          `json:"-"`
+	OnRequest            StateOnRequest            `json:"-"`
+	OnResponse           StateOnResponse           `json:"-"`
+	OnEnd                StateOnEnd                `json:"-"`
+	OnError              StateOnError              `json:"-"`
+	// Context cancels running tool calls and stops the loop before the next turn when done
+	Context context.Context `json:"-"`
+	// Pending holds the assistant message of a turn suspended for approval or interrupted until the state is resumed
+	Pending *call.AssistantMessage `json:"pending"`
+	// Approvals holds decisions for pending tool calls keyed by tool call id
+	Approvals map[string]*Approval `json:"approvals"`
+	// Discovered holds names of tools found through tool search that stay exposed with a tool selector
+	Discovered []string `json:"discovered"`
+	// Cache memoises results of cacheable declarations within the run
+	Cache map[string]*CacheEntry `json:"cache"`
+	// Summary replaces older tool messages removed by compaction
+	Summary *Summary `json:"summary"`
+	// Budget holds resources spent by previous runs of the state
+	Budget *Budget `json:"budget"`
+	mutex  *sync.Mutex
 }
 
 // NewState creates a new function calling state with initial messages
@@ -25,22 +74,77 @@ func NewState(initialMessages []call.Message) *State {
 	return &State{
 		InitialMessages: initialMessages,
 		ToolMessages:    make([]*call.AssistantMessage, 0),
+		mutex:           new(sync.Mutex),
 	}
 }
 
-// Messages returns all messages in chronological order
+// StateVersion is the version of the json format written by State, states of a newer version are rejected
+const StateVersion = 1
+
+// MarshalJSON writes the state with its format version, callback hooks and context are not serialised
+func (r *State) MarshalJSON() ([]byte, error) {
+	type state State
+	return json.Marshal(&struct {
+		Version int `json:"version"`
+		*state
+	}{
+		Version: StateVersion,
+		state:   (*state)(r),
+	})
+}
+
+// UnmarshalJSON reads a state written by MarshalJSON, keeping callback hooks and context already set on the state
+func (r *State) UnmarshalJSON(data []byte) error {
+	type state State
+	document := &struct {
+		Version int `json:"version"`
+		*state
+	}{
+		state: (*state)(r),
+	}
+	if err := json.Unmarshal(data, document); err != nil {
+		return err
+	}
+	if document.Version > StateVersion {
+		return fmt.Errorf("unsupported state version %d, latest supported is %d", document.Version, StateVersion)
+	}
+	if r.ToolMessages == nil {
+		r.ToolMessages = make([]*call.AssistantMessage, 0)
+	}
+	if r.mutex == nil {
+		r.mutex = new(sync.Mutex)
+	}
+	return nil
+}
+
+// Messages returns all messages in chronological order, compacted tool messages are replaced by their summary
 func (r *State) Messages() []call.Message {
 	messages := make([]call.Message, 0)
 	messages = append(messages, r.InitialMessages...)
+	if r.Summary != nil {
+		messages = append(messages, r.Summary.Message())
+	}
 	for _, toolMessage := range r.ToolMessages {
 		messages = append(messages, toolMessage)
 	}
 	return messages
 }
 
-// Inherit copies callback hooks from another state
+// Inherit copies callback and lifecycle hooks and context from another state, so hooks also observe subagent runs,
+// lifecycle hooks receive the subagent state to tell its runs apart by id,
+// tool choice hook is not copied as it is specific to the tools of a state
 func (r *State) Inherit(state *State) {
 	r.OnBeforeFunctionCall = state.OnBeforeFunctionCall
 	r.OnAfterFunctionCall = state.OnAfterFunctionCall
 	r.OnToolMessage = state.OnToolMessage
+	r.OnTurnStart = state.OnTurnStart
+	r.OnRequest = state.OnRequest
+	r.OnResponse = state.OnResponse
+	r.OnEnd = state.OnEnd
+	r.OnError = state.OnError
+	r.Context = state.Context
+	if state.mutex == nil {
+		state.mutex = new(sync.Mutex)
+	}
+	r.mutex = state.mutex
 }
@@ -0,0 +1,44 @@
+package function
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bsthun/gut"
+	"github.com/stretchr/testify/assert"
+	"go.scnd.dev/open/model/agentic/package/call"
+)
+
+func TestStateJson(t *testing.T) {
+	state := NewState([]call.Message{
+		&call.SystemMessage{Content: gut.Ptr("You are helpful")},
+		&call.UserMessage{Content: gut.Ptr("What is the weather?")},
+	})
+	state.ToolMessages = append(state.ToolMessages, &call.AssistantMessage{
+		ToolCalls: []*call.ToolCall{
+			{
+				Id:        gut.Ptr("call_1"),
+				Name:      gut.Ptr("current_weather"),
+				Arguments: []byte(`{"city":"Bangkok"}`),
+				Result:    []byte(`{"temperature":31}`),
+			},
+		},
+	})
+	state.Discovered = []string{"current_weather"}
+
+	content, err := json.Marshal(state)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), `"version":1`)
+
+	restored := new(State)
+	assert.Nil(t, json.Unmarshal(content, restored))
+	assert.Equal(t, state.Messages(), restored.Messages())
+	assert.Equal(t, state.Discovered, restored.Discovered)
+	assert.NotNil(t, restored.mutex)
+
+	t.Run("NewerVersion", func(t *testing.T) {
+		err := json.Unmarshal([]byte(`{"version":99,"initialMessages":[]}`), new(State))
+
+		assert.NotNil(t, err)
+	})
+}
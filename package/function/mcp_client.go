@@ -2,12 +2,15 @@ package function
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/bsthun/gut"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.scnd.dev/open/model/agentic/package/call"
 )
 
 // McpClient wraps an MCP client for tool execution
@@ -24,10 +27,23 @@ func NewMcpClient(r client.MCPClient, toolName *string) *McpClient {
 	}
 }
 
-// Execute calls the MCP tool with the provided arguments
+// Execute calls the MCP tool with the provided arguments,
+// content parts are dropped from the result, use ExecuteContext to keep them
 func (r *McpClient) Execute(arguments any) (map[string]any, *gut.ErrorInstance) {
-	ctx := context.Background()
+	response, err := r.ExecuteContext(context.Background(), arguments)
+	if err != nil {
+		return nil, err
+	}
+	if result, ok := response.(*Result); ok {
+		response = result.Value
+	}
+	value, _ := response.(map[string]any)
+	return value, nil
+}
 
+// ExecuteContext calls the MCP tool with the provided arguments, cancelling the call when ctx is done,
+// contents other than the first text are attached to the result as content parts
+func (r *McpClient) ExecuteContext(ctx context.Context, arguments any) (any, *gut.ErrorInstance) {
 	// * create mcp call tool request
 	callRequest := mcp.CallToolRequest{
 		Params: mcp.CallToolParams{
@@ -42,18 +58,27 @@ func (r *McpClient) Execute(arguments any) (map[string]any, *gut.ErrorInstance)
 		return nil, gut.Err(false, fmt.Sprintf("failed to call mcp tool: %v", err))
 	}
 
-	// * convert tool result to response
-	var result map[string]any
-	if len(toolResult.Content) > 0 {
-		// * select content
-		content := toolResult.Content[0]
+	return McpResult(toolResult)
+}
 
+// McpResult converts every content of an MCP tool result, the first text content becomes the json result value
+// and later text, image, audio and resource contents are attached to the result as content parts
+func McpResult(toolResult *mcp.CallToolResult) (any, *gut.ErrorInstance) {
+	var result map[string]any
+	parts := make([]*call.ContentPart, 0)
+	for i, content := range toolResult.Content {
 		if textContent, ok := mcp.AsTextContent(content); ok {
+			if result != nil || i > 0 {
+				parts = append(parts, call.NewTextPart(textContent.Text))
+				continue
+			}
+
 			// * fallback for empty result
 			if len(textContent.Text) == 0 {
-				return map[string]any{
+				result = map[string]any{
 					"success": true,
-				}, nil
+				}
+				continue
 			}
 
 			// * unmarshal text content
@@ -63,10 +88,55 @@ func (r *McpClient) Execute(arguments any) (map[string]any, *gut.ErrorInstance)
 					"r": textContent.Text,
 				}
 			}
+		} else if imageContent, ok := mcp.AsImageContent(content); ok {
+			// * forward image content as content part
+			data, err := base64.StdEncoding.DecodeString(imageContent.Data)
+			if err != nil {
+				return nil, gut.Err(false, "failed to decode mcp image content", err)
+			}
+			parts = append(parts, call.NewImagePart(data, imageContent.MIMEType))
+		} else if audioContent, ok := mcp.AsAudioContent(content); ok {
+			// * describe audio content as models take no audio tool results
+			parts = append(parts, call.NewTextPart("[audio content of type "+audioContent.MIMEType+" omitted]"))
+		} else if resource, ok := mcp.AsEmbeddedResource(content); ok {
+			part, err := McpResourcePart(resource.Resource)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		} else if link, ok := content.(mcp.ResourceLink); ok {
+			parts = append(parts, call.NewTextPart("Resource "+link.Name+": "+link.URI))
 		} else {
 			return nil, gut.Err(false, "unsupported mcp content type", nil)
 		}
 	}
 
-	return result, nil
+	if len(parts) == 0 {
+		return result, nil
+	}
+	if result == nil {
+		result = map[string]any{
+			"success": true,
+		}
+	}
+	return NewResult(result, parts...), nil
+}
+
+// McpResourcePart converts embedded resource contents to a content part,
+// binary images become image parts and other binary contents become document parts
+func McpResourcePart(resource mcp.ResourceContents) (*call.ContentPart, *gut.ErrorInstance) {
+	if textResource, ok := mcp.AsTextResourceContents(resource); ok {
+		return call.NewTextPart(textResource.Text), nil
+	}
+	if blobResource, ok := mcp.AsBlobResourceContents(resource); ok {
+		data, err := base64.StdEncoding.DecodeString(blobResource.Blob)
+		if err != nil {
+			return nil, gut.Err(false, "failed to decode mcp resource content", err)
+		}
+		if strings.HasPrefix(blobResource.MIMEType, "image/") {
+			return call.NewImagePart(data, blobResource.MIMEType), nil
+		}
+		return call.NewDocumentPart(data, blobResource.MIMEType, blobResource.URI), nil
+	}
+	return nil, gut.Err(false, "unsupported mcp resource content type", nil)
 }
@@ -2,9 +2,11 @@ package function
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
+	"github.com/bsthun/gut"
 	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -96,6 +98,9 @@ func McpDeclarations(source *string, option *McpOption) ([]*Declaration, error)
 			Arguments:       new(map[string]any),
 			ArgumentsSchema: schema,
 			Func:            wrapper.Execute,
+			FuncContext: func(ctx *DeclarationContext, arguments any) (any, *gut.ErrorInstance) {
+				return wrapper.ExecuteContext(ctx, arguments)
+			},
 		}
 		declarations = append(declarations, declaration)
 	}
@@ -105,29 +110,16 @@ func McpDeclarations(source *string, option *McpOption) ([]*Declaration, error)
 
 // McpSchemaToCallSchema converts MCP tool input schema to call schema
 func McpSchemaToCallSchema(inputSchema mcp.ToolInputSchema) (*call.Schema, error) {
-	schema := new(call.Schema)
-
-	// * set type
-	if inputSchema.Type != "" {
-		schema.Type = &inputSchema.Type
-	}
-
-	// * set required
-	if len(inputSchema.Required) > 0 {
-		schema.Required = make([]*string, len(inputSchema.Required))
-		for i, req := range inputSchema.Required {
-			reqCopy := req
-			schema.Required[i] = &reqCopy
-		}
+	// * marshal input schema back to json schema document
+	document, err := json.Marshal(inputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal mcp input schema: %w", err)
 	}
 
-	// * set properties
-	if len(inputSchema.Properties) > 0 {
-		schema.Properties = make(map[string]*call.Schema)
-		for key, value := range inputSchema.Properties {
-			propSchema := call.SchemaConvert(value)
-			schema.Properties[key] = propSchema
-		}
+	// * parse json schema document losslessly
+	schema, parseErr := call.SchemaParse(document)
+	if parseErr != nil {
+		return nil, parseErr
 	}
 
 	return schema, nil
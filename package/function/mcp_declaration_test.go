@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/bsthun/gut"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/stretchr/testify/assert"
 	"go.scnd.dev/open/model/agentic/package/call"
 )
@@ -115,3 +116,37 @@ func TestMcpDeclarations(t *testing.T) {
 		t.Logf("Final response: %s", finalResponse)
 	})
 }
+
+func TestMcpResult(t *testing.T) {
+	t.Run("FirstText", func(t *testing.T) {
+		result, err := McpResult(&mcp.CallToolResult{
+			Content: []mcp.Content{mcp.NewTextContent(`{"count": 2}`)},
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]any{"count": float64(2)}, result)
+	})
+
+	t.Run("EveryContent", func(t *testing.T) {
+		result, err := McpResult(&mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.NewTextContent("first"),
+				mcp.NewTextContent("second"),
+				mcp.NewImageContent("iVBO", "image/png"),
+				mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "file:///a.txt", Text: "resource"}),
+				mcp.NewEmbeddedResource(mcp.BlobResourceContents{URI: "file:///a.pdf", MIMEType: "application/pdf", Blob: "JVBE"}),
+			},
+		})
+
+		assert.Nil(t, err)
+		assert.IsType(t, new(Result), result)
+		assert.Equal(t, map[string]any{"r": "first"}, result.(*Result).Value)
+		parts := result.(*Result).Parts
+		assert.Len(t, parts, 4)
+		assert.Equal(t, "second", *parts[0].Text)
+		assert.Equal(t, call.ContentPartTypeImage, *parts[1].Type)
+		assert.Equal(t, "resource", *parts[2].Text)
+		assert.Equal(t, call.ContentPartTypeDocument, *parts[3].Type)
+		assert.Equal(t, "file:///a.pdf", *parts[3].Name)
+	})
+}
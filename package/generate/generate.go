@@ -0,0 +1,349 @@
+// Package generate generates function declaration registries from annotated go functions,
+// descriptions come from doc comments of functions and fields of their parameter structs.
+package generate
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/bsthun/gut"
+)
+
+// Directive marks a function to generate a declaration for, optionally followed by the declaration name
+const Directive = "//agentic:declaration"
+
+// Function is an annotated function to generate a declaration for
+type Function struct {
+	Name        string
+	Declaration string
+	Description string
+	Arguments   string
+	Context     bool
+}
+
+// Argument is a parameter struct whose field docs become schema descriptions
+type Argument struct {
+	Name   string
+	Fields []*Field
+}
+
+// Field is a documented field of a parameter struct
+type Field struct {
+	Key         string
+	Description string
+}
+
+// Package holds annotated functions and parameter structs of a scanned package
+type Package struct {
+	Name      string
+	Functions []*Function
+	Arguments []*Argument
+}
+
+// Scan parses go files of dir, excluding tests and output, and collects annotated functions
+func Scan(dir string, output string) (*Package, *gut.ErrorInstance) {
+	fileSet := token.NewFileSet()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, gut.Err(false, "failed to read package directory", err)
+	}
+
+	files := make([]*ast.File, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == output {
+			continue
+		}
+		file, err := parser.ParseFile(fileSet, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, gut.Err(false, "failed to parse "+name, err)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, gut.Err(false, "no go files in "+dir)
+	}
+
+	// * index struct types for parameter lookup
+	structs := make(map[string]*ast.StructType)
+	describers := make(map[string]bool)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+						if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+							structs[typeSpec.Name.Name] = structType
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv != nil && decl.Name.Name == "SchemaDescribe" {
+					describers[ScanReceiver(decl.Recv.List[0].Type)] = true
+				}
+			}
+		}
+	}
+
+	pkg := &Package{
+		Name:      files[0].Name.Name,
+		Functions: make([]*Function, 0),
+		Arguments: make([]*Argument, 0),
+	}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Recv != nil || funcDecl.Doc == nil {
+				continue
+			}
+			directive, ok := ScanDirective(funcDecl.Doc)
+			if !ok {
+				continue
+			}
+
+			function, err := ScanFunction(funcDecl, directive)
+			if err != nil {
+				return nil, err
+			}
+			pkg.Functions = append(pkg.Functions, function)
+
+			// * collect field docs of parameter struct once
+			if seen[function.Arguments] || describers[function.Arguments] {
+				continue
+			}
+			seen[function.Arguments] = true
+			if structType, ok := structs[function.Arguments]; ok {
+				if argument := ScanArgument(function.Arguments, structType); len(argument.Fields) > 0 {
+					pkg.Arguments = append(pkg.Arguments, argument)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(pkg.Functions, func(i, j int) bool {
+		return pkg.Functions[i].Declaration < pkg.Functions[j].Declaration
+	})
+
+	return pkg, nil
+}
+
+// ScanDirective returns the arguments of the declaration directive in doc, and whether the directive is present
+func ScanDirective(doc *ast.CommentGroup) (string, bool) {
+	for _, comment := range doc.List {
+		if comment.Text == Directive || strings.HasPrefix(comment.Text, Directive+" ") {
+			return strings.TrimSpace(strings.TrimPrefix(comment.Text, Directive)), true
+		}
+	}
+	return "", false
+}
+
+// ScanFunction validates the signature of an annotated function,
+// accepted forms are func(*Arguments) (R, *gut.ErrorInstance) and func(*function.DeclarationContext, *Arguments) (R, *gut.ErrorInstance)
+func ScanFunction(funcDecl *ast.FuncDecl, directive string) (*Function, *gut.ErrorInstance) {
+	name := funcDecl.Name.Name
+	invalid := gut.Err(false, "annotated function "+name+" must have signature func([ctx *function.DeclarationContext,] arguments *Arguments) (R, *gut.ErrorInstance)")
+
+	params := make([]ast.Expr, 0)
+	for _, field := range funcDecl.Type.Params.List {
+		count := max(len(field.Names), 1)
+		for i := 0; i < count; i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if len(params) < 1 || len(params) > 2 || funcDecl.Type.Results == nil || funcDecl.Type.Results.NumFields() != 2 {
+		return nil, invalid
+	}
+
+	pointer, ok := params[len(params)-1].(*ast.StarExpr)
+	if !ok {
+		return nil, invalid
+	}
+	arguments, ok := pointer.X.(*ast.Ident)
+	if !ok {
+		return nil, invalid
+	}
+
+	declaration := directive
+	if declaration == "" {
+		declaration = SnakeCase(name)
+	}
+
+	return &Function{
+		Name:        name,
+		Declaration: declaration,
+		Description: ScanDescription(name, funcDecl.Doc),
+		Arguments:   arguments.Name,
+		Context:     len(params) == 2,
+	}, nil
+}
+
+// ScanDescription returns the doc comment of a function as its description,
+// the leading go identifier of the doc convention is dropped so the model only sees the described behaviour
+func ScanDescription(name string, doc *ast.CommentGroup) string {
+	words := strings.Fields(doc.Text())
+	if len(words) > 1 && words[0] == name {
+		runes := []rune(words[1])
+		runes[0] = unicode.ToUpper(runes[0])
+		words[1] = string(runes)
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// ScanArgument collects docs of exported fields without description tag keyed by their json name
+func ScanArgument(name string, structType *ast.StructType) *Argument {
+	argument := &Argument{
+		Name:   name,
+		Fields: make([]*Field, 0),
+	}
+	for _, field := range structType.Fields.List {
+		doc := field.Doc
+		if doc == nil {
+			doc = field.Comment
+		}
+		if doc == nil || len(field.Names) == 0 {
+			continue
+		}
+		tag := reflect.StructTag("")
+		if field.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(field.Tag.Value, "`"))
+		}
+		if _, ok := tag.Lookup("description"); ok {
+			continue
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			key := strings.Split(tag.Get("json"), ",")[0]
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = ident.Name
+			}
+			argument.Fields = append(argument.Fields, &Field{
+				Key:         key,
+				Description: strings.Join(strings.Fields(doc.Text()), " "),
+			})
+		}
+	}
+	return argument
+}
+
+// ScanReceiver returns the type name of a method receiver
+func ScanReceiver(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// SnakeCase converts a go identifier such as GetWeather into get_weather
+func SnakeCase(name string) string {
+	builder := new(strings.Builder)
+	runes := []rune(name)
+	for i, c := range runes {
+		if unicode.IsUpper(c) {
+			boundary := i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])))
+			if boundary {
+				builder.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
+
+// Generate scans dir and renders the formatted declaration registry source
+func Generate(dir string, output string) ([]byte, *gut.ErrorInstance) {
+	pkg, err := Scan(dir, output)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := registry.Execute(buffer, pkg); err != nil {
+		return nil, gut.Err(false, "failed to render declaration registry", err)
+	}
+	source, formatErr := format.Source(buffer.Bytes())
+	if formatErr != nil {
+		return nil, gut.Err(false, "failed to format declaration registry", formatErr)
+	}
+	return source, nil
+}
+
+var registry = template.Must(template.New("registry").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`// Code generated by agentic declaration generator. DO NOT EDIT.
+
+package {{ .Name }}
+
+import (
+	"github.com/bsthun/gut"
+{{- if .Arguments }}
+	"go.scnd.dev/open/model/agentic/package/call"
+{{- end }}
+	"go.scnd.dev/open/model/agentic/package/function"
+)
+
+// Declarations returns function declarations generated from annotated functions
+func Declarations() []*function.Declaration {
+	return []*function.Declaration{
+{{- range .Functions }}
+		Declaration{{ .Name }}(),
+{{- end }}
+	}
+}
+
+// RegisterDeclarations passes generated declarations to add, such as function.Call.AddDeclaration or agent.Agent.AddFunction
+func RegisterDeclarations(add func(declaration *function.Declaration)) {
+	for _, declaration := range Declarations() {
+		add(declaration)
+	}
+}
+{{ range .Functions }}
+// Declaration{{ .Name }} creates the {{ .Declaration }} declaration of {{ .Name }}
+func Declaration{{ .Name }}() *function.Declaration {
+	return function.NewDeclarationResult(
+		gut.Ptr({{ quote .Declaration }}),
+		gut.Ptr({{ quote .Description }}),
+		func(ctx *function.DeclarationContext, arguments *{{ .Arguments }}) (any, *gut.ErrorInstance) {
+			result, err := {{ .Name }}({{ if .Context }}ctx, {{ end }}arguments)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		},
+	)
+}
+{{ end }}
+{{- range .Arguments }}
+// SchemaDescribe describes fields of {{ .Name }} from their doc comments
+func (r *{{ .Name }}) SchemaDescribe() *call.Schema {
+	return &call.Schema{
+		Properties: map[string]*call.Schema{
+{{- range .Fields }}
+			{{ quote .Key }}: {Description: gut.Ptr({{ quote .Description }})},
+{{- end }}
+		},
+	}
+}
+{{ end }}`))
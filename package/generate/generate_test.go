@@ -0,0 +1,57 @@
+package generate
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Run("Scan", func(t *testing.T) {
+		pkg, err := Scan("testdata/weather", "declaration_generated.go")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "weather", pkg.Name)
+		assert.Len(t, pkg.Functions, 2)
+		assert.Equal(t, "get_weather", pkg.Functions[0].Declaration)
+		assert.Equal(t, "Returns the current weather of a city. The temperature is in celsius unless unit is set.", pkg.Functions[0].Description)
+		assert.False(t, pkg.Functions[0].Context)
+		assert.Equal(t, "weather_forecast", pkg.Functions[1].Declaration)
+		assert.True(t, pkg.Functions[1].Context)
+		assert.Len(t, pkg.Arguments, 1)
+		assert.Equal(t, []*Field{
+			{Key: "city", Description: "City to look up, such as Bangkok"},
+			{Key: "days", Description: "Number of forecast days"},
+		}, pkg.Arguments[0].Fields)
+	})
+
+	t.Run("Source", func(t *testing.T) {
+		source, err := Generate("testdata/weather", "declaration_generated.go")
+
+		assert.Nil(t, err)
+
+		// * build scanned package with generated source overlaid into it
+		dir, _ := filepath.Abs(filepath.Join("testdata", "weather"))
+		generated := filepath.Join(t.TempDir(), "declaration_generated.go")
+		assert.NoError(t, os.WriteFile(generated, source, 0o644))
+		overlay, _ := json.Marshal(map[string]any{
+			"Replace": map[string]string{filepath.Join(dir, "declaration_generated.go"): generated},
+		})
+		overlayPath := filepath.Join(t.TempDir(), "overlay.json")
+		assert.NoError(t, os.WriteFile(overlayPath, overlay, 0o644))
+		output, buildErr := exec.Command("go", "build", "-overlay", overlayPath, "./testdata/weather").CombinedOutput()
+		assert.NoError(t, buildErr, string(output))
+		assert.Contains(t, string(source), `result, err := Forecast(ctx, arguments)`)
+		assert.Contains(t, string(source), `func (r *WeatherArguments) SchemaDescribe() *call.Schema {`)
+	})
+}
+
+func TestSnakeCase(t *testing.T) {
+	assert.Equal(t, "get_weather", SnakeCase("GetWeather"))
+	assert.Equal(t, "read_url_content", SnakeCase("ReadURLContent"))
+	assert.Equal(t, "search", SnakeCase("search"))
+}
@@ -0,0 +1,37 @@
+package weather
+
+import (
+	"github.com/bsthun/gut"
+	"go.scnd.dev/open/model/agentic/package/function"
+)
+
+type WeatherArguments struct {
+	// City to look up, such as Bangkok
+	City *string `json:"city" validate:"required"`
+	Unit *string `json:"unit" description:"Temperature unit"` // ignored since tag is set
+	Days *int    `json:"days"`                                // Number of forecast days
+}
+
+type Weather struct {
+	Temperature *float64 `json:"temperature"`
+}
+
+// GetWeather returns the current weather of a city.
+// The temperature is in celsius unless unit is set.
+//
+//agentic:declaration
+func GetWeather(arguments *WeatherArguments) (*Weather, *gut.ErrorInstance) {
+	return &Weather{Temperature: gut.Ptr(31.5)}, nil
+}
+
+// Forecast returns the forecast of a city.
+//
+//agentic:declaration weather_forecast
+func Forecast(ctx *function.DeclarationContext, arguments *WeatherArguments) (map[string]any, *gut.ErrorInstance) {
+	return map[string]any{"days": arguments.Days}, nil
+}
+
+// Helper is not annotated and has no declaration
+func Helper(arguments *WeatherArguments) (*Weather, *gut.ErrorInstance) {
+	return nil, nil
+}